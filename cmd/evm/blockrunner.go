@@ -0,0 +1,127 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/tests"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var TraceFlag = cli.BoolFlag{
+	Name:  "trace",
+	Usage: "output JSON trace logs of the executed transactions to stderr",
+}
+
+var blockTestCommand = cli.Command{
+	Action:    blockTestCmd,
+	Name:      "blocktest",
+	Usage:     "executes the given blockchain tests",
+	ArgsUsage: "<file>",
+	Flags:     []cli.Flag{TraceFlag},
+}
+
+type BlocktestResult struct {
+	Name  string          `json:"name"`
+	Pass  bool            `json:"pass"`
+	Fork  string          `json:"fork"`
+	Error string          `json:"error,omitempty"`
+	Block *BlocktestBlock `json:"failedBlock,omitempty"`
+}
+
+// BlocktestBlock contains the details of the block a blockchain test failed at.
+type BlocktestBlock struct {
+	Number   uint64       `json:"number"`
+	Hash     common.Hash  `json:"hash"`
+	WantRoot *common.Hash `json:"wantStateRoot,omitempty"`
+	HaveRoot *common.Hash `json:"haveStateRoot,omitempty"`
+}
+
+func blockTestCmd(ctx *cli.Context) error {
+	if len(ctx.Args().First()) == 0 {
+		return errors.New("path-to-test argument required")
+	}
+	// Configure the go-ethereum logger
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.GlobalInt(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	// Configure the EVM logger
+	cfg := vm.Config{}
+	if ctx.Bool(TraceFlag.Name) {
+		config := &vm.LogConfig{
+			DisableMemory: ctx.GlobalBool(DisableMemoryFlag.Name),
+			DisableStack:  ctx.GlobalBool(DisableStackFlag.Name),
+		}
+		cfg.Debug, cfg.Tracer = true, NewJSONLogger(config, os.Stderr)
+	}
+	// Load the test content from the input file
+	src, err := ioutil.ReadFile(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	var blocktests map[string]tests.BlockTest
+	if err = json.Unmarshal(src, &blocktests); err != nil {
+		return err
+	}
+	out, _ := json.MarshalIndent(runBlockTests(blocktests, cfg), "", "  ")
+	fmt.Println(string(out))
+	return nil
+}
+
+// runBlockTests executes the given blockchain tests in the order of their names,
+// reporting the block each failing test stopped at, if known.
+func runBlockTests(blocktests map[string]tests.BlockTest, cfg vm.Config) []BlocktestResult {
+	names := make([]string, 0, len(blocktests))
+	for name := range blocktests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Iterate over all the tests, run them and aggregate the results
+	results := make([]BlocktestResult, 0, len(blocktests))
+	for _, name := range names {
+		test := blocktests[name]
+
+		result := BlocktestResult{Name: name, Fork: test.Network(), Pass: true}
+		if err := test.Run(cfg); err != nil {
+			result.Pass, result.Error = false, err.Error()
+			if failure, ok := err.(*tests.BlockTestError); ok {
+				result.Block = &BlocktestBlock{
+					Number:   failure.Number,
+					Hash:     failure.Hash,
+					HaveRoot: failure.HaveRoot,
+				}
+				if failure.WantRoot != (common.Hash{}) {
+					result.Block.WantRoot = &failure.WantRoot
+				}
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
@@ -0,0 +1,62 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// Tests that blockchain tests failing after all their blocks were imported, on
+// the last block hash or the post state, report the block they failed at.
+func TestBlockTestFailures(t *testing.T) {
+	var blocktests map[string]tests.BlockTest
+	if err := readJSONFile(filepath.Join("testdata", "blocktest", "failing.json"), &blocktests); err != nil {
+		t.Fatalf("failed to load blockchain tests: %v", err)
+	}
+	genesis := common.HexToHash("0xedb30a2a1072656b03c832c3e952e8d346336b7baafd70ba160962ff5ff5fa79")
+
+	results := runBlockTests(blocktests, vm.Config{})
+	if len(results) != 2 {
+		t.Fatalf("result count mismatch: have %d, want 2", len(results))
+	}
+	for _, result := range results {
+		if result.Pass {
+			t.Errorf("%s: passed, expected failure", result.Name)
+			continue
+		}
+		if result.Block == nil {
+			t.Errorf("%s: failing block missing: %s", result.Name, result.Error)
+			continue
+		}
+		if result.Block.Number != 0 || result.Block.Hash != genesis {
+			t.Errorf("%s: failing block mismatch: have #%d [%x], want #0 [%x]", result.Name, result.Block.Number, result.Block.Hash, genesis)
+		}
+		// Neither failure has a known expected state root to report
+		if result.Block.WantRoot != nil || result.Block.HaveRoot != nil {
+			t.Errorf("%s: unexpected state roots: want %v, have %v", result.Name, result.Block.WantRoot, result.Block.HaveRoot)
+		}
+		if result.Name == "wrongPostState" && !strings.Contains(result.Error, "balance mismatch for addr: a94f5374fce5edbc8e2a8697c15331677e6ebf0b") {
+			t.Errorf("%s: mismatching account not reported: %s", result.Name, result.Error)
+		}
+	}
+}
@@ -144,6 +144,8 @@ func init() {
 		disasmCommand,
 		runCommand,
 		stateTestCommand,
+		blockTestCommand,
+		transitionCommand,
 	}
 }
 
@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"os"
 	"runtime/pprof"
+	"strings"
 	"time"
 
 	goruntime "runtime"
@@ -34,18 +35,35 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	cli "gopkg.in/urfave/cli.v1"
 )
 
+var (
+	ProfileFlag = cli.BoolFlag{
+		Name:  "profile",
+		Usage: "output the gas spent per opcode, contract and program counter to stderr",
+	}
+	SourceMapFlag = cli.StringFlag{
+		Name:  "sourcemap",
+		Usage: "file containing the solc source map of the executed code, for the gas profile",
+	}
+	SourcesFlag = cli.StringFlag{
+		Name:  "sources",
+		Usage: "comma separated source files referenced by the source map, in solc source id order",
+	}
+)
+
 var runCommand = cli.Command{
 	Action:      runCmd,
 	Name:        "run",
 	Usage:       "run arbitrary evm binary",
 	ArgsUsage:   "<code>",
 	Description: `The run command runs arbitrary EVM code.`,
+	Flags:       []cli.Flag{ProfileFlag, SourceMapFlag, SourcesFlag},
 }
 
 // readGenesis will read the given JSON format genesis file and return
@@ -69,6 +87,28 @@ func readGenesis(genesisPath string) *core.Genesis {
 	return genesis
 }
 
+// readSourceMap will read the given solc source map file and the source files
+// it references, returning the parsed source map.
+func readSourceMap(srcmapPath string, sourcePaths []string) *vm.SourceMap {
+	mapping, err := ioutil.ReadFile(srcmapPath)
+	if err != nil {
+		utils.Fatalf("Failed to read source map: %v", err)
+	}
+	var files []vm.SourceFile
+	for _, path := range sourcePaths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			utils.Fatalf("Failed to read source file: %v", err)
+		}
+		files = append(files, vm.SourceFile{Name: path, Content: string(content)})
+	}
+	srcmap, err := vm.NewSourceMap(string(bytes.TrimSpace(mapping)), files)
+	if err != nil {
+		utils.Fatalf("Invalid source map: %v", err)
+	}
+	return srcmap
+}
+
 func runCmd(ctx *cli.Context) error {
 	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
 	glogger.Verbosity(log.Lvl(ctx.GlobalInt(VerbosityFlag.Name)))
@@ -81,6 +121,7 @@ func runCmd(ctx *cli.Context) error {
 	var (
 		tracer      vm.Tracer
 		debugLogger *vm.StructLogger
+		profiler    *vm.GasProfiler
 		statedb     *state.StateDB
 		chainConfig *params.ChainConfig
 		sender      = common.StringToAddress("sender")
@@ -112,6 +153,23 @@ func runCmd(ctx *cli.Context) error {
 	if ctx.GlobalString(ReceiverFlag.Name) != "" {
 		receiver = common.HexToAddress(ctx.GlobalString(ReceiverFlag.Name))
 	}
+	if ctx.Bool(ProfileFlag.Name) {
+		// The source map belongs to the executed code, which is the created
+		// contract in case of contract creation
+		srcmaps := make(map[common.Address]*vm.SourceMap)
+		if ctx.String(SourceMapFlag.Name) != "" {
+			var sources []string
+			if ctx.String(SourcesFlag.Name) != "" {
+				sources = strings.Split(ctx.String(SourcesFlag.Name), ",")
+			}
+			addr := receiver
+			if ctx.GlobalBool(CreateFlag.Name) {
+				addr = crypto.CreateAddress(sender, statedb.GetNonce(sender))
+			}
+			srcmaps[addr] = readSourceMap(ctx.String(SourceMapFlag.Name), sources)
+		}
+		profiler = vm.NewGasProfiler(srcmaps)
+	}
 
 	var (
 		code []byte
@@ -166,6 +224,13 @@ func runCmd(ctx *cli.Context) error {
 			DisableGasMetering: ctx.GlobalBool(DisableGasMeteringFlag.Name),
 		},
 	}
+	if profiler != nil {
+		if tracer != nil {
+			utils.Fatalf("Gas profiling cannot be combined with --debug or --json")
+		}
+		runtimeConfig.EVMConfig.Tracer = profiler
+		runtimeConfig.EVMConfig.Debug = true
+	}
 
 	if cpuProfilePath := ctx.GlobalString(CPUProfileFlag.Name); cpuProfilePath != "" {
 		f, err := os.Create(cpuProfilePath)
@@ -223,6 +288,12 @@ func runCmd(ctx *cli.Context) error {
 		vm.WriteLogs(os.Stderr, statedb.Logs())
 	}
 
+	if profiler != nil {
+		fmt.Fprintln(os.Stderr, "#### GAS PROFILE ####")
+		profile, _ := json.MarshalIndent(profiler.Profile(), "", "  ")
+		fmt.Fprintln(os.Stderr, string(profile))
+	}
+
 	if ctx.GlobalBool(StatDumpFlag.Name) {
 		var mem goruntime.MemStats
 		goruntime.ReadMemStats(&mem)
@@ -0,0 +1,391 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/tests"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	InputAllocFlag = cli.StringFlag{
+		Name:  "input.alloc",
+		Usage: "`stdin` or file name of where to find the prestate alloc to use",
+		Value: "alloc.json",
+	}
+	InputEnvFlag = cli.StringFlag{
+		Name:  "input.env",
+		Usage: "`stdin` or file name of where to find the prestate env to use",
+		Value: "env.json",
+	}
+	InputTxsFlag = cli.StringFlag{
+		Name:  "input.txs",
+		Usage: "`stdin` or file name of where to find the transactions to apply",
+		Value: "txs.json",
+	}
+	OutputAllocFlag = cli.StringFlag{
+		Name:  "output.alloc",
+		Usage: "Determines where to put the post-state alloc (`stdout`, `stderr` or file name)",
+		Value: "alloc.json",
+	}
+	OutputResultFlag = cli.StringFlag{
+		Name:  "output.result",
+		Usage: "Determines where to put the execution result (`stdout`, `stderr` or file name)",
+		Value: "result.json",
+	}
+	ForkFlag = cli.StringFlag{
+		Name:  "state.fork",
+		Usage: fmt.Sprintf("Name of the fork rules to use, one of %s", strings.Join(forkNames(), ", ")),
+		Value: "Istanbul",
+	}
+	ChainIdFlag = cli.Int64Flag{
+		Name:  "state.chainid",
+		Usage: "Chain id to use for signature verification and the CHAINID opcode",
+		Value: 1,
+	}
+	NoRewardFlag = cli.BoolFlag{
+		Name:  "state.noreward",
+		Usage: "Skip crediting the block and ommer mining rewards",
+	}
+)
+
+var transitionCommand = cli.Command{
+	Action: transitionCmd,
+	Name:   "t8n",
+	Usage:  "executes a full state transition",
+	Flags: []cli.Flag{
+		InputAllocFlag,
+		InputEnvFlag,
+		InputTxsFlag,
+		OutputAllocFlag,
+		OutputResultFlag,
+		ForkFlag,
+		ChainIdFlag,
+		NoRewardFlag,
+	},
+}
+
+// transitionEnv is the block environment the transactions are executed in.
+type transitionEnv struct {
+	Coinbase   common.Address        `json:"currentCoinbase"`
+	Difficulty *math.HexOrDecimal256 `json:"currentDifficulty"`
+	GasLimit   math.HexOrDecimal64   `json:"currentGasLimit"`
+	Number     math.HexOrDecimal64   `json:"currentNumber"`
+	Timestamp  math.HexOrDecimal64   `json:"currentTimestamp"`
+	Ommers     []transitionOmmer     `json:"ommers,omitempty"`
+}
+
+// transitionOmmer is an ommer included in the block, rewarded for mining.
+type transitionOmmer struct {
+	Delta   uint64         `json:"delta"`   // Distance of the ommer from the current block
+	Address common.Address `json:"address"` // Coinbase of the ommer
+}
+
+// transitionInput is the combined input of the state transition, used when
+// any of the parts are read from the standard input.
+type transitionInput struct {
+	Alloc core.GenesisAlloc    `json:"alloc,omitempty"`
+	Env   *transitionEnv       `json:"env,omitempty"`
+	Txs   []*types.Transaction `json:"txs,omitempty"`
+}
+
+// rejectedTx is a transaction which could not be included in the block.
+type rejectedTx struct {
+	Index int    `json:"index"`
+	Err   string `json:"error"`
+}
+
+// transitionResult is the outcome of the state transition.
+type transitionResult struct {
+	StateRoot   common.Hash         `json:"stateRoot"`
+	TxRoot      common.Hash         `json:"txRoot"`
+	ReceiptRoot common.Hash         `json:"receiptRoot"`
+	LogsHash    common.Hash         `json:"logsHash"`
+	Bloom       types.Bloom         `json:"logsBloom"`
+	Receipts    types.Receipts      `json:"receipts"`
+	Rejected    []*rejectedTx       `json:"rejected,omitempty"`
+	GasUsed     math.HexOrDecimal64 `json:"gasUsed"`
+}
+
+// transitionChain is the chain context of the state transition. There's no
+// chain history available, so BLOCKHASH always evaluates to zero.
+type transitionChain struct{}
+
+func (transitionChain) Engine() consensus.Engine                    { return ethash.NewFaker() }
+func (transitionChain) GetHeader(common.Hash, uint64) *types.Header { return nil }
+
+// forkNames returns the sorted names of the supported forks.
+func forkNames() []string {
+	names := make([]string, 0, len(tests.Forks))
+	for name := range tests.Forks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func transitionCmd(ctx *cli.Context) error {
+	// Configure the go-ethereum logger
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.GlobalInt(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	// Assemble the chain configuration of the requested fork
+	fork, ok := tests.Forks[ctx.String(ForkFlag.Name)]
+	if !ok {
+		return fmt.Errorf("unsupported fork %q, expected one of %s", ctx.String(ForkFlag.Name), strings.Join(forkNames(), ", "))
+	}
+	config := *fork
+	config.ChainId = big.NewInt(ctx.Int64(ChainIdFlag.Name))
+
+	// Load the prestate, the environment and the transactions
+	input, err := loadTransitionInput(ctx)
+	if err != nil {
+		return err
+	}
+	alloc, result, err := applyTransition(&config, input, !ctx.Bool(NoRewardFlag.Name))
+	if err != nil {
+		return err
+	}
+	return writeTransitionOutput(ctx, alloc, result)
+}
+
+// applyTransition executes the transactions on top of the prestate within the
+// block environment, optionally crediting the mining rewards, and returns the
+// post-state alloc along with the execution result.
+func applyTransition(config *params.ChainConfig, input *transitionInput, reward bool) (core.GenesisAlloc, *transitionResult, error) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb := tests.MakePreState(db, input.Alloc)
+
+	header := &types.Header{
+		Coinbase:   input.Env.Coinbase,
+		Difficulty: (*big.Int)(input.Env.Difficulty),
+		GasLimit:   uint64(input.Env.GasLimit),
+		Number:     new(big.Int).SetUint64(uint64(input.Env.Number)),
+		Time:       new(big.Int).SetUint64(uint64(input.Env.Timestamp)),
+	}
+	if header.Difficulty == nil {
+		header.Difficulty = new(big.Int)
+	}
+	var (
+		gaspool  = new(core.GasPool).AddGas(header.GasLimit)
+		included types.Transactions
+		result   = new(transitionResult)
+	)
+	for i, tx := range input.Txs {
+		statedb.Prepare(tx.Hash(), common.Hash{}, len(included))
+
+		// Rejected transactions may have already bought their gas, so restore
+		// the block's gas pool along with the state
+		var (
+			snapshot = statedb.Snapshot()
+			gas      = gaspool.Gas()
+		)
+		receipt, _, err := core.ApplyTransaction(config, transitionChain{}, &header.Coinbase, gaspool, statedb, header, tx, &header.GasUsed, vm.Config{})
+		if err != nil {
+			statedb.RevertToSnapshot(snapshot)
+			*gaspool = core.GasPool(gas)
+			log.Info("Rejected transaction", "index", i, "hash", tx.Hash(), "err", err)
+			result.Rejected = append(result.Rejected, &rejectedTx{Index: i, Err: err.Error()})
+			continue
+		}
+		included = append(included, tx)
+		result.Receipts = append(result.Receipts, receipt)
+	}
+	if reward {
+		ommers := make([]*types.Header, 0, len(input.Env.Ommers))
+		for i, ommer := range input.Env.Ommers {
+			if ommer.Delta == 0 || ommer.Delta > 6 || ommer.Delta > header.Number.Uint64() {
+				return nil, nil, fmt.Errorf("ommer %d: invalid delta %d", i, ommer.Delta)
+			}
+			ommers = append(ommers, &types.Header{
+				Number:   new(big.Int).Sub(header.Number, new(big.Int).SetUint64(ommer.Delta)),
+				Coinbase: ommer.Address,
+			})
+		}
+		ethash.AccumulateRewards(config, statedb, header, ommers)
+	}
+	root, err := statedb.Commit(config.IsEIP158(header.Number))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to commit state: %v", err)
+	}
+	result.StateRoot = root
+	result.TxRoot = types.DeriveSha(included)
+	result.ReceiptRoot = types.DeriveSha(result.Receipts)
+	result.LogsHash = logsHash(result.Receipts)
+	result.Bloom = types.CreateBloom(result.Receipts)
+	result.GasUsed = math.HexOrDecimal64(header.GasUsed)
+	if result.Receipts == nil {
+		result.Receipts = types.Receipts{}
+	}
+	alloc, err := dumpAlloc(statedb)
+	if err != nil {
+		return nil, nil, err
+	}
+	return alloc, result, nil
+}
+
+// loadTransitionInput reads the prestate alloc, the environment and the list of
+// transactions from their files, or from the standard input if requested.
+func loadTransitionInput(ctx *cli.Context) (*transitionInput, error) {
+	var (
+		allocPath = ctx.String(InputAllocFlag.Name)
+		envPath   = ctx.String(InputEnvFlag.Name)
+		txsPath   = ctx.String(InputTxsFlag.Name)
+		input     = new(transitionInput)
+	)
+	if allocPath == "stdin" || envPath == "stdin" || txsPath == "stdin" {
+		if err := json.NewDecoder(os.Stdin).Decode(input); err != nil {
+			return nil, fmt.Errorf("failed to decode stdin: %v", err)
+		}
+	}
+	if allocPath != "stdin" {
+		if err := readJSONFile(allocPath, &input.Alloc); err != nil {
+			return nil, err
+		}
+	}
+	if envPath != "stdin" {
+		if err := readJSONFile(envPath, &input.Env); err != nil {
+			return nil, err
+		}
+	}
+	if txsPath != "stdin" {
+		if err := readJSONFile(txsPath, &input.Txs); err != nil {
+			return nil, err
+		}
+	}
+	if input.Env == nil {
+		return nil, errors.New("missing block environment")
+	}
+	return input, nil
+}
+
+// readJSONFile decodes the JSON content of the given file into val.
+func readJSONFile(path string, val interface{}) error {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(blob, val); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	return nil
+}
+
+// dumpAlloc converts the committed state into a genesis allocation, which can
+// be used as the prestate of a subsequent transition.
+func dumpAlloc(statedb *state.StateDB) (core.GenesisAlloc, error) {
+	alloc := make(core.GenesisAlloc)
+	for addr, account := range statedb.RawDump().Accounts {
+		balance, ok := new(big.Int).SetString(account.Balance, 10)
+		if !ok {
+			return nil, fmt.Errorf("account %s: invalid balance %s", addr, account.Balance)
+		}
+		genesis := core.GenesisAccount{
+			Balance: balance,
+			Nonce:   account.Nonce,
+			Code:    common.FromHex(account.Code),
+		}
+		if len(account.Storage) > 0 {
+			genesis.Storage = make(map[common.Hash]common.Hash, len(account.Storage))
+		}
+		for key, val := range account.Storage {
+			_, content, _, err := rlp.Split(common.FromHex(val))
+			if err != nil {
+				return nil, fmt.Errorf("account %s: invalid storage slot %s: %v", addr, key, err)
+			}
+			genesis.Storage[common.HexToHash(key)] = common.BytesToHash(content)
+		}
+		alloc[common.HexToAddress(addr)] = genesis
+	}
+	return alloc, nil
+}
+
+// writeTransitionOutput writes the post-state alloc and the execution result to
+// their requested destinations. Outputs directed to the same standard stream
+// are combined into a single JSON object.
+func writeTransitionOutput(ctx *cli.Context, alloc core.GenesisAlloc, result *transitionResult) error {
+	streams := map[string]map[string]interface{}{
+		"stdout": make(map[string]interface{}),
+		"stderr": make(map[string]interface{}),
+	}
+	outputs := []struct {
+		name, dest string
+		val        interface{}
+	}{
+		{"alloc", ctx.String(OutputAllocFlag.Name), alloc},
+		{"result", ctx.String(OutputResultFlag.Name), result},
+	}
+	for _, output := range outputs {
+		if stream, ok := streams[output.dest]; ok {
+			stream[output.name] = output.val
+			continue
+		}
+		blob, err := json.MarshalIndent(output.val, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(output.dest, blob, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", output.name, err)
+		}
+	}
+	for name, file := range map[string]*os.File{"stdout": os.Stdout, "stderr": os.Stderr} {
+		if len(streams[name]) == 0 {
+			continue
+		}
+		blob, err := json.MarshalIndent(streams[name], "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(file, string(blob))
+	}
+	return nil
+}
+
+// logsHash returns the keccak256 hash of the RLP encoding of all the logs in
+// the given receipts, in the order of execution.
+func logsHash(receipts types.Receipts) common.Hash {
+	logs := make([]*types.Log, 0)
+	for _, receipt := range receipts {
+		logs = append(logs, receipt.Logs...)
+	}
+	blob, _ := rlp.EncodeToBytes(logs)
+	return crypto.Keccak256Hash(blob)
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// Tests that a state transition includes the valid transactions, rejects the
+// invalid ones without them consuming any block gas, and produces the expected
+// post state.
+func TestTransition(t *testing.T) {
+	input := new(transitionInput)
+	for name, val := range map[string]interface{}{"alloc.json": &input.Alloc, "env.json": &input.Env, "txs.json": &input.Txs} {
+		if err := readJSONFile(filepath.Join("testdata", "t8n", name), val); err != nil {
+			t.Fatalf("failed to load %s: %v", name, err)
+		}
+	}
+	config := *tests.Forks["Istanbul"]
+	config.ChainId = big.NewInt(1)
+
+	alloc, result, err := applyTransition(&config, input, true)
+	if err != nil {
+		t.Fatalf("failed to apply transition: %v", err)
+	}
+	// The transaction with too little intrinsic gas is rejected, but the one
+	// after it must still fit into the block
+	if len(result.Rejected) != 1 || result.Rejected[0].Index != 1 {
+		t.Fatalf("rejected transactions mismatch: have %+v, want index 1", result.Rejected)
+	}
+	if len(result.Receipts) != 2 {
+		t.Fatalf("receipt count mismatch: have %d, want 2", len(result.Receipts))
+	}
+	if result.GasUsed != 42000 {
+		t.Errorf("gas used mismatch: have %d, want 42000", result.GasUsed)
+	}
+	if have := alloc[common.HexToAddress("0xbb")].Balance; have.Cmp(big.NewInt(2000)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v, want 2000", have)
+	}
+	// Sender paid 2 * (1000 wei + 21000 gas), coinbase earned the fees and 3 ether
+	if want := common.HexToHash("0x0cdc107300475c2186124c03d5b485fcd217a32e19e95fa6d4d8a552c4962cd7"); result.StateRoot != want {
+		t.Errorf("state root mismatch: have %x, want %x", result.StateRoot, want)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
+	"github.com/ethereum/go-ethereum/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	bloomFilterSizeFlag = cli.Uint64Flag{
+		Name:  "bloomfilter.size",
+		Usage: "Megabytes of memory allocated to the bloom filter used for pruning",
+		Value: 2048,
+	}
+	retainStatesFlag = cli.IntFlag{
+		Name:  "retain",
+		Usage: "Number of most recent states to retain when pruning",
+		Value: 1,
+	}
+	snapshotCommand = cli.Command{
+		Name:     "snapshot",
+		Usage:    "A set of commands based on the state data",
+		Category: "MISCELLANEOUS COMMANDS",
+		Description: `
+Offline maintenance operations on the state data stored in the database.`,
+		Subcommands: []cli.Command{
+			{
+				Name:      "prune-state",
+				Usage:     "Prune stale ethereum state data",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(pruneState),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.AncientThresholdFlag,
+					utils.CacheFlag,
+					utils.CacheDatabaseFlag,
+					utils.TestnetFlag,
+					utils.RinkebyFlag,
+					bloomFilterSizeFlag,
+					retainStatesFlag,
+				},
+				Description: `
+geth snapshot prune-state --retain 128
+
+will mark all the state data reachable from the most recent 128 states that are
+available in the database (plus the genesis state), and delete every other trie
+node and contract code from the chain database in place.
+
+The marked data is tracked in a bloom filter persisted into the data directory,
+so an interrupted pruning is resumed by running the command again. Some stale
+data may be retained due to the false positive rate of the bloom filter, which
+can be lowered by allocating more memory to it via --bloomfilter.size.
+
+The node must not be running while pruning.`,
+			},
+		},
+	}
+)
+
+// pruneState deletes all the state data not reachable from the most recent
+// states in the database.
+func pruneState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	pruner, err := pruner.NewPruner(chaindb, stack.InstanceDir(), ctx.Uint64(bloomFilterSizeFlag.Name))
+	if err != nil {
+		log.Error("Failed to open state pruner", "err", err)
+		return err
+	}
+	if err := pruner.Prune(ctx.Int(retainStatesFlag.Name)); err != nil {
+		log.Error("Failed to prune state", "err", err)
+		return err
+	}
+	return nil
+}
@@ -18,6 +18,7 @@
 package utils
 
 import (
+	"bufio"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -26,8 +27,11 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/internal/debug"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
@@ -222,3 +226,48 @@ func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, las
 	log.Info("Exported blockchain to", "file", fn)
 	return nil
 }
+
+// ExportState streams the given state into the specified file in the compact
+// binary state dump format, gzipping it if the file name ends in ".gz".
+func ExportState(statedb *state.StateDB, fn string) error {
+	log.Info("Exporting state", "file", fn)
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	buffer := bufio.NewWriter(writer)
+	if _, _, err := statedb.ExportDump(buffer); err != nil {
+		return err
+	}
+	if err := buffer.Flush(); err != nil {
+		return err
+	}
+	log.Info("Exported state", "file", fn)
+	return nil
+}
+
+// ImportState rebuilds the state contained in the specified state dump file in
+// the database, returning its root hash.
+func ImportState(db ethdb.Database, fn string) (common.Hash, error) {
+	log.Info("Importing state", "file", fn)
+	fh, err := os.Open(fn)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer fh.Close()
+
+	var reader io.Reader = fh
+	if strings.HasSuffix(fn, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	return state.ImportDump(db, bufio.NewReader(reader))
+}
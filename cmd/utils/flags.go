@@ -118,6 +118,19 @@ var (
 		Usage: "Data directory for the databases and keystore",
 		Value: DirectoryString{node.DefaultDataDir()},
 	}
+	AncientFlag = DirectoryFlag{
+		Name:  "datadir.ancient",
+		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
+	}
+	AncientThresholdFlag = cli.Uint64Flag{
+		Name:  "datadir.ancient.threshold",
+		Usage: "Number of recent blocks to keep out of the ancient store (0 = disable ancient store)",
+		Value: eth.DefaultConfig.ImmutabilityThreshold,
+	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: `Backing database implementation ("leveldb", "boltdb", default = existing database's or leveldb)`,
+	}
 	KeyStoreDirFlag = DirectoryFlag{
 		Name:  "keystore",
 		Usage: "Directory for the keystore (default = inside the datadir)",
@@ -175,6 +188,19 @@ var (
 		Usage: `Blockchain garbage collection mode ("full", "archive")`,
 		Value: "full",
 	}
+	SnapshotFlag = cli.BoolFlag{
+		Name:  "snapshot",
+		Usage: "Maintain a flat state snapshot for faster state access (experimental)",
+	}
+	StateDiffsFlag = cli.BoolFlag{
+		Name:  "statediffs",
+		Usage: "Store reverse state diffs to serve historical state without an archive node",
+	}
+	StateDiffLimitFlag = cli.Uint64Flag{
+		Name:  "statediffs.limit",
+		Usage: "Maximum number of blocks historical states may be rolled back by, older diffs are pruned",
+		Value: eth.DefaultConfig.StateDiffLimit,
+	}
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
 		Usage: "Maximum percentage of time allowed for serving LES requests (0-90)",
@@ -259,6 +285,16 @@ var (
 		Usage: "Time interval to regenerate the local transaction journal",
 		Value: core.DefaultTxPoolConfig.Rejournal,
 	}
+	TxPoolSnapshotFlag = cli.StringFlag{
+		Name:  "txpool.snapshot",
+		Usage: "Disk snapshot of all (local and remote) transactions to survive node restarts",
+		Value: core.DefaultTxPoolConfig.Snapshot,
+	}
+	TxPoolResnapshotFlag = cli.DurationFlag{
+		Name:  "txpool.resnapshot",
+		Usage: "Time interval to regenerate the transaction pool snapshot",
+		Value: core.DefaultTxPoolConfig.Resnapshot,
+	}
 	TxPoolPriceLimitFlag = cli.Uint64Flag{
 		Name:  "txpool.pricelimit",
 		Usage: "Minimum gas price limit to enforce for acceptance into the pool",
@@ -294,6 +330,10 @@ var (
 		Usage: "Maximum amount of time non-executable transaction are queued",
 		Value: eth.DefaultConfig.TxPool.Lifetime,
 	}
+	TxPoolPolicyAPIFlag = cli.BoolFlag{
+		Name:  "txpool.policyapi",
+		Usage: "Enable txpool_setPolicy and txpool_clearPolicy (WARNING: anyone with access to the txpool RPC namespace can replace the admission policy)",
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
@@ -325,10 +365,29 @@ var (
 		Usage: "Number of CPU threads to use for mining",
 		Value: runtime.NumCPU(),
 	}
+	MinerOrderingFlag = cli.StringFlag{
+		Name:  "minerordering",
+		Usage: `Ordering of the transactions in mined blocks ("price", "arrival" or a registered one)`,
+		Value: "price",
+	}
+	MinerPriorityFlag = cli.StringFlag{
+		Name:  "minerpriority",
+		Usage: "Comma separated accounts whose transactions are included first into mined blocks",
+	}
+	MinerGasFloorFlag = cli.Uint64Flag{
+		Name:  "minergasfloor",
+		Usage: "Target gas floor for the blocks to mine",
+		Value: eth.DefaultConfig.MinerGasFloor,
+	}
+	MinerGasCeilFlag = cli.Uint64Flag{
+		Name:  "minergasceil",
+		Usage: "Target gas ceiling for the blocks to mine (0 = no ceiling)",
+		Value: eth.DefaultConfig.MinerGasCeil,
+	}
 	TargetGasLimitFlag = cli.Uint64Flag{
 		Name:  "targetgaslimit",
-		Usage: "Target gas limit sets the artificial target gas floor for the blocks to mine",
-		Value: params.GenesisGasLimit,
+		Usage: "Target gas limit sets the artificial target gas floor for the blocks to mine (deprecated, use --minergasfloor)",
+		Value: eth.DefaultConfig.MinerGasFloor,
 	}
 	EtherbaseFlag = cli.StringFlag{
 		Name:  "etherbase",
@@ -888,6 +947,14 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 		cfg.DataDir = filepath.Join(node.DefaultDataDir(), "rinkeby")
 	}
 
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		switch engine := ctx.GlobalString(DBEngineFlag.Name); engine {
+		case ethdb.EngineLevelDB, ethdb.EngineBoltDB:
+			cfg.DatabaseEngine = engine
+		default:
+			Fatalf("--%s must be either '%s' or '%s'", DBEngineFlag.Name, ethdb.EngineLevelDB, ethdb.EngineBoltDB)
+		}
+	}
 	if ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
 		cfg.KeyStoreDir = ctx.GlobalString(KeyStoreDirFlag.Name)
 	}
@@ -908,6 +975,29 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	}
 }
 
+// precompiles are the custom precompiled contracts registered via RegisterPrecompile.
+var precompiles = make(map[common.Address]vm.CustomPrecompile)
+
+// RegisterPrecompile adds a custom precompiled contract, activated at the given
+// address from the given block onwards, to both the node and the chain of the
+// offline commands (import, export, dump, ...). As the contracts cannot be set
+// from the command line, builds of geth for private networks relying on them
+// must register them before running any command, otherwise blocks would be
+// processed under different rules than the rest of the network.
+func RegisterPrecompile(addr common.Address, block *big.Int, contract vm.PrecompiledContract) {
+	precompiles[addr] = vm.CustomPrecompile{Contract: contract, Block: block}
+}
+
+// setPrecompiles adds the registered custom precompiled contracts to the given set.
+func setPrecompiles(set *map[common.Address]vm.CustomPrecompile) {
+	for addr, precompile := range precompiles {
+		if *set == nil {
+			*set = make(map[common.Address]vm.CustomPrecompile)
+		}
+		(*set)[addr] = precompile
+	}
+}
+
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolNoLocalsFlag.Name) {
 		cfg.NoLocals = ctx.GlobalBool(TxPoolNoLocalsFlag.Name)
@@ -918,6 +1008,12 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolRejournalFlag.Name) {
 		cfg.Rejournal = ctx.GlobalDuration(TxPoolRejournalFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolSnapshotFlag.Name) {
+		cfg.Snapshot = ctx.GlobalString(TxPoolSnapshotFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolResnapshotFlag.Name) {
+		cfg.Resnapshot = ctx.GlobalDuration(TxPoolResnapshotFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolPriceLimitFlag.Name) {
 		cfg.PriceLimit = ctx.GlobalUint64(TxPoolPriceLimitFlag.Name)
 	}
@@ -939,6 +1035,9 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolPolicyAPIFlag.Name) {
+		cfg.PolicyAPI = ctx.GlobalBool(TxPoolPolicyAPIFlag.Name)
+	}
 }
 
 func setEthash(ctx *cli.Context, cfg *eth.Config) {
@@ -1022,6 +1121,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	setEtherbase(ctx, ks, cfg)
 	setGPO(ctx, &cfg.GPO)
 	setTxPool(ctx, &cfg.TxPool)
+	setPrecompiles(&cfg.Precompiles)
 	setEthash(ctx, cfg)
 
 	switch {
@@ -1042,6 +1142,12 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
 
+	if ctx.GlobalIsSet(AncientFlag.Name) {
+		cfg.DatabaseFreezer = ctx.GlobalString(AncientFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientThresholdFlag.Name) {
+		cfg.ImmutabilityThreshold = ctx.GlobalUint64(AncientThresholdFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheDatabaseFlag.Name) {
 		cfg.DatabaseCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheDatabaseFlag.Name) / 100
 	}
@@ -1051,6 +1157,11 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
 	}
 	cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
+	cfg.Snapshot = ctx.GlobalBool(SnapshotFlag.Name)
+	cfg.StateDiffs = ctx.GlobalBool(StateDiffsFlag.Name)
+	if ctx.GlobalIsSet(StateDiffLimitFlag.Name) {
+		cfg.StateDiffLimit = ctx.GlobalUint64(StateDiffLimitFlag.Name)
+	}
 
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
@@ -1058,6 +1169,26 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(MinerThreadsFlag.Name) {
 		cfg.MinerThreads = ctx.GlobalInt(MinerThreadsFlag.Name)
 	}
+	if ctx.GlobalIsSet(TargetGasLimitFlag.Name) {
+		cfg.MinerGasFloor = ctx.GlobalUint64(TargetGasLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerGasFloorFlag.Name) {
+		cfg.MinerGasFloor = ctx.GlobalUint64(MinerGasFloorFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerGasCeilFlag.Name) {
+		cfg.MinerGasCeil = ctx.GlobalUint64(MinerGasCeilFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerOrderingFlag.Name) {
+		cfg.MinerOrdering = ctx.GlobalString(MinerOrderingFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerPriorityFlag.Name) {
+		for _, account := range strings.Split(ctx.GlobalString(MinerPriorityFlag.Name), ",") {
+			if account = strings.TrimSpace(account); !common.IsHexAddress(account) {
+				Fatalf("Invalid account in --%s: %s", MinerPriorityFlag.Name, account)
+			}
+			cfg.MinerPrioritySenders = append(cfg.MinerPrioritySenders, common.HexToAddress(account))
+		}
+	}
 	if ctx.GlobalIsSet(DocRootFlag.Name) {
 		cfg.DocRoot = ctx.GlobalString(DocRootFlag.Name)
 	}
@@ -1177,12 +1308,6 @@ func RegisterEthStatsService(stack *node.Node, url string) {
 	}
 }
 
-// SetupNetwork configures the system for either the main net or some test network.
-func SetupNetwork(ctx *cli.Context) {
-	// TODO(fjl): move target gas limit into config
-	params.TargetGasLimit = ctx.GlobalUint64(TargetGasLimitFlag.Name)
-}
-
 // MakeChainDatabase open an LevelDB using the flags passed to the client and will hard crash if it fails.
 func MakeChainDatabase(ctx *cli.Context, stack *node.Node) ethdb.Database {
 	var (
@@ -1197,7 +1322,32 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node) ethdb.Database {
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
 	}
-	return chainDb
+	// Full nodes move immutable chain segments into the ancient store, so the
+	// offline tools need to see it too to access old blocks. The migration of
+	// chain data itself is left to the node, the tools only read the freezer.
+	ancient := MakeAncientDir(ctx, stack)
+	if ctx.GlobalBool(LightModeFlag.Name) || stack.ResolvePath(name) == "" || !common.FileExist(ancient) {
+		return chainDb
+	}
+	frdb, err := core.NewDatabaseWithReadOnlyFreezer(chainDb, ancient)
+	if err != nil {
+		chainDb.Close()
+		Fatalf("Could not open ancient database: %v", err)
+	}
+	return frdb
+}
+
+// MakeAncientDir resolves the directory of the ancient chain store, defaulting
+// to a folder within the chain database.
+func MakeAncientDir(ctx *cli.Context, stack *node.Node) string {
+	switch freezer := ctx.GlobalString(AncientFlag.Name); {
+	case freezer == "":
+		return filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+	case !filepath.IsAbs(freezer):
+		return stack.ResolvePath(freezer)
+	default:
+		return freezer
+	}
 }
 
 func MakeGenesis(ctx *cli.Context) *core.Genesis {
@@ -1242,14 +1392,19 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
 	}
 	cache := &core.CacheConfig{
-		Disabled:      ctx.GlobalString(GCModeFlag.Name) == "archive",
-		TrieNodeLimit: eth.DefaultConfig.TrieCache,
-		TrieTimeLimit: eth.DefaultConfig.TrieTimeout,
+		Disabled:       ctx.GlobalString(GCModeFlag.Name) == "archive",
+		TrieNodeLimit:  eth.DefaultConfig.TrieCache,
+		TrieTimeLimit:  eth.DefaultConfig.TrieTimeout,
+		Snapshot:       ctx.GlobalBool(SnapshotFlag.Name),
+		StateDiffs:     ctx.GlobalBool(StateDiffsFlag.Name),
+		StateDiffLimit: ctx.GlobalUint64(StateDiffLimitFlag.Name),
 	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cache.TrieNodeLimit = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
 	vmcfg := vm.Config{EnablePreimageRecording: ctx.GlobalBool(VMEnableDebugFlag.Name)}
+	setPrecompiles(&vmcfg.Precompiles)
+
 	chain, err = core.NewBlockChain(chainDb, cache, config, engine, vmcfg)
 	if err != nil {
 		Fatalf("Can't create BlockChain: %v", err)
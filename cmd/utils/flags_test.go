@@ -0,0 +1,65 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/node"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// Tests that the registered custom precompiled contracts are active in the chain
+// of the offline commands too, so blocks are processed under the same rules.
+func TestMakeChainPrecompiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geth-utils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stack, err := node.New(&node.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	GCModeFlag.Apply(set)
+	FakePoWFlag.Apply(set)
+	set.Set(FakePoWFlag.Name, "true")
+
+	addr := common.BytesToAddress([]byte{0x01, 0x00})
+	RegisterPrecompile(addr, big.NewInt(5), vm.PrecompiledContractsByzantium[common.BytesToAddress([]byte{4})])
+	defer delete(precompiles, addr)
+
+	chain, db := MakeChain(cli.NewContext(nil, set, nil), stack)
+	defer db.Close()
+	defer chain.Stop()
+
+	precompile, ok := chain.GetVMConfig().Precompiles[addr]
+	if !ok {
+		t.Fatalf("custom precompile missing from the chain configuration")
+	}
+	if precompile.Block == nil || precompile.Block.Cmp(big.NewInt(5)) != 0 {
+		t.Errorf("activation block mismatch: have %v, want %v", precompile.Block, 5)
+	}
+}
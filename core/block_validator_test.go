@@ -197,3 +197,30 @@ func testHeaderConcurrentAbortion(t *testing.T, threads int) {
 		t.Errorf("verification count too large: have %d, want below %d", verified, 2*threads)
 	}
 }
+
+// Tests that the gas limit of new blocks is steered towards the configured floor
+// and ceiling, moving at most the allowed step per block.
+func TestCalcGasLimit(t *testing.T) {
+	tests := []struct {
+		parent, used      uint64
+		gasFloor, gasCeil uint64
+		want              uint64
+	}{
+		// Within range, two thirds usage keeps the limit (almost) unchanged
+		{parent: 6144000, used: 4096000, gasFloor: 5000000, gasCeil: 7000000, want: 6144001},
+		// Below the floor, increase by the maximum step or up to the floor
+		{parent: 1024000, used: 0, gasFloor: 5000000, gasCeil: 7000000, want: 1024000 + 999},
+		{parent: 4999000, used: 0, gasFloor: 5000000, gasCeil: 7000000, want: 5000000},
+		// Above the ceiling, decrease by the maximum step or down to the ceiling
+		{parent: 10240000, used: 10240000, gasFloor: 5000000, gasCeil: 7000000, want: 10240000 - 9999},
+		{parent: 7001000, used: 7001000, gasFloor: 5000000, gasCeil: 7000000, want: 7000000},
+		// Without a ceiling, full blocks keep raising the limit
+		{parent: 10240000, used: 10240000, gasFloor: 5000000, gasCeil: 0, want: 10240000 - 9999 + 15000},
+	}
+	for i, tt := range tests {
+		parent := types.NewBlockWithHeader(&types.Header{GasLimit: tt.parent, GasUsed: tt.used})
+		if have := CalcGasLimit(parent, tt.gasFloor, tt.gasCeil); have != tt.want {
+			t.Errorf("test %d: gas limit mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
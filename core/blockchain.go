@@ -51,6 +51,10 @@ var (
 	ErrNoGenesis = errors.New("Genesis not found in chain")
 )
 
+// DefaultStateDiffLimit is the default maximum number of blocks the current state
+// may be rolled back by via the reverse state diffs. Older diffs are pruned.
+const DefaultStateDiffLimit = 16384
+
 const (
 	bodyCacheLimit      = 256
 	blockCacheLimit     = 256
@@ -66,9 +70,12 @@ const (
 // CacheConfig contains the configuration values for the trie caching/pruning
 // that's resident in a blockchain.
 type CacheConfig struct {
-	Disabled      bool          // Whether to disable trie write caching (archive node)
-	TrieNodeLimit int           // Memory limit (MB) at which to flush the current in-memory trie to disk
-	TrieTimeLimit time.Duration // Time limit after which to flush the current in-memory trie to disk
+	Disabled       bool          // Whether to disable trie write caching (archive node)
+	TrieNodeLimit  int           // Memory limit (MB) at which to flush the current in-memory trie to disk
+	TrieTimeLimit  time.Duration // Time limit after which to flush the current in-memory trie to disk
+	Snapshot       bool          // Whether to maintain a flat state snapshot for faster state reads
+	StateDiffs     bool          // Whether to store reverse state diffs for historical state access
+	StateDiffLimit uint64        // Maximum number of blocks historical states may be rolled back by (0 = default)
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -140,6 +147,11 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 			TrieTimeLimit: 5 * time.Minute,
 		}
 	}
+	if cacheConfig.StateDiffs && cacheConfig.StateDiffLimit == 0 {
+		config := *cacheConfig
+		config.StateDiffLimit = DefaultStateDiffLimit
+		cacheConfig = &config
+	}
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
@@ -176,6 +188,10 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
 	}
+	// Load or generate the flat state snapshot on top of the recovered head state
+	if cacheConfig.Snapshot {
+		bc.stateCache = state.NewDatabaseWithSnapshots(db, bc.CurrentBlock().Root())
+	}
 	// Check the current state of the block hashes and make sure that we do not have any of the bad blocks in our chain
 	for hash := range BadHashes {
 		if header := bc.GetHeaderByHash(hash); header != nil {
@@ -268,10 +284,18 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	// Rewind the header chain, deleting all block bodies until then
 	delFn := func(hash common.Hash, num uint64) {
 		DeleteBody(bc.db, hash, num)
+		DeleteStateDiff(bc.db, hash, num)
 	}
 	bc.hc.SetHead(head, delFn)
 	currentHeader := bc.hc.CurrentHeader()
 
+	// Discard any frozen chain segment above the new head too
+	if store, ok := bc.db.(AncientStore); ok && store.Ancients() > currentHeader.Number.Uint64()+1 {
+		if err := store.TruncateAncients(currentHeader.Number.Uint64() + 1); err != nil {
+			log.Error("Failed to truncate ancient chain data", "err", err)
+		}
+	}
+
 	// Clear out any stale content from the caches
 	bc.bodyCache.Purge()
 	bc.bodyRLPCache.Purge()
@@ -305,7 +329,11 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	if err := WriteHeadFastBlockHash(bc.db, bc.currentFastBlock.Hash()); err != nil {
 		log.Crit("Failed to reset head fast block", "err", err)
 	}
-	return bc.loadLastState()
+	if err := bc.loadLastState(); err != nil {
+		return err
+	}
+	bc.ensureSnapshot(bc.currentBlock.Root())
+	return nil
 }
 
 // FastSyncCommitHead sets the current head block to the one defined by the hash
@@ -324,10 +352,20 @@ func (bc *BlockChain) FastSyncCommitHead(hash common.Hash) error {
 	bc.currentBlock = block
 	bc.mu.Unlock()
 
+	bc.ensureSnapshot(block.Root())
+
 	log.Info("Committed new head block", "number", block.Number(), "hash", hash)
 	return nil
 }
 
+// ensureSnapshot makes sure the flat state snapshot, if enabled, covers the given
+// state root, regenerating it from scratch if the head was moved outside of it.
+func (bc *BlockChain) ensureSnapshot(root common.Hash) {
+	if snaps := bc.stateCache.Snapshots(); snaps != nil && snaps.Snapshot(root) == nil {
+		snaps.Rebuild(root)
+	}
+}
+
 // GasLimit returns the gas limit of the current HEAD block.
 func (bc *BlockChain) GasLimit() uint64 {
 	bc.mu.RLock()
@@ -392,6 +430,50 @@ func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return state.New(root, bc.stateCache)
 }
 
+// HistoricState returns a read only state of a canonical block, falling back to
+// rolling the nearest available newer state back via the stored reverse state
+// diffs if the block's own state was already pruned. Blocks further behind the
+// head than the configured rollback limit are rejected.
+func (bc *BlockChain) HistoricState(header *types.Header) (*state.StateDB, error) {
+	if statedb, err := state.New(header.Root, bc.stateCache); err == nil {
+		return statedb, nil
+	}
+	number := header.Number.Uint64()
+	if GetCanonicalHash(bc.db, number) != header.Hash() {
+		return nil, fmt.Errorf("historic state unavailable for non-canonical block #%d [%x…]", number, header.Hash().Bytes()[:4])
+	}
+	head := bc.CurrentBlock().NumberU64()
+	if limit := bc.cacheConfig.StateDiffLimit; number < head && head-number > limit {
+		return nil, fmt.Errorf("historic state of block #%d beyond rollback limit of %d blocks", number, limit)
+	}
+	// Gather the diffs up until the first block with a live state
+	var diffs []*state.StateDiff
+	for n := number + 1; n <= head; n++ {
+		next := bc.GetHeaderByNumber(n)
+		if next == nil {
+			return nil, fmt.Errorf("missing canonical header #%d", n)
+		}
+		diff := GetStateDiff(bc.db, next.Hash(), n)
+		if diff == nil {
+			return nil, fmt.Errorf("missing state diff for block #%d [%x…]", n, next.Hash().Bytes()[:4])
+		}
+		diffs = append(diffs, diff)
+
+		statedb, err := state.New(next.Root, bc.stateCache)
+		if err != nil {
+			continue
+		}
+		// Roll the state back, newest diff first
+		for i := len(diffs) - 1; i >= 0; i-- {
+			if err := statedb.RevertDiff(diffs[i]); err != nil {
+				return nil, err
+			}
+		}
+		return statedb, nil
+	}
+	return nil, fmt.Errorf("no live state found after block #%d", number)
+}
+
 // Reset purges the entire blockchain, restoring it to its genesis state.
 func (bc *BlockChain) Reset() error {
 	return bc.ResetWithGenesisBlock(bc.genesisBlock)
@@ -544,8 +626,10 @@ func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
 	if bc.blockCache.Contains(hash) {
 		return true
 	}
-	ok, _ := bc.db.Has(blockBodyKey(hash, number))
-	return ok
+	if ok, _ := bc.db.Has(blockBodyKey(hash, number)); ok {
+		return true
+	}
+	return isAncient(bc.db, hash, number)
 }
 
 // HasState checks if state trie is fully present in the database or not.
@@ -665,6 +749,12 @@ func (bc *BlockChain) Stop() {
 			if err := triedb.Commit(recent.Root(), true); err != nil {
 				log.Error("Failed to commit recent state trie", "err", err)
 			}
+			// Flatten the snapshot down to the persisted state so it's usable on restart
+			if snaps := bc.stateCache.Snapshots(); snaps != nil {
+				if err := snaps.Cap(recent.Root(), 0); err != nil {
+					log.Error("Failed to flatten state snapshot", "err", err)
+				}
+			}
 		}
 		for !bc.triegc.Empty() {
 			triedb.Dereference(bc.triegc.PopItem().(common.Hash), common.Hash{})
@@ -673,6 +763,15 @@ func (bc *BlockChain) Stop() {
 			log.Error("Dangling trie nodes after full cleanup")
 		}
 	}
+	// Flush the snapshot generator progress before the database goes away
+	if snaps := bc.stateCache.Snapshots(); snaps != nil {
+		if bc.cacheConfig.Disabled {
+			if err := snaps.Cap(bc.CurrentBlock().Root(), 0); err != nil {
+				log.Error("Failed to flatten state snapshot", "err", err)
+			}
+		}
+		snaps.Close()
+	}
 	log.Info("Blockchain manager stopped")
 }
 
@@ -897,6 +996,15 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 	if err != nil {
 		return NonStatTy, err
 	}
+	if diff := state.Diff(); diff != nil {
+		if err := WriteStateDiff(batch, block.Hash(), block.NumberU64(), diff); err != nil {
+			return NonStatTy, err
+		}
+		// Prune the diffs falling out of the rollback window
+		if limit := bc.cacheConfig.StateDiffLimit; block.NumberU64() > limit {
+			DeleteStateDiffs(bc.db, batch, block.NumberU64()-limit)
+		}
+	}
 	triedb := bc.stateCache.TrieDB()
 
 	// If we're running an archive node, always flush
@@ -1133,10 +1241,14 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 		} else {
 			parent = chain[i-1]
 		}
-		state, err := state.New(parent.Root(), bc.stateCache)
+		state, err := bc.StateAt(parent.Root())
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
+		// Only block import records the reverse state diffs
+		if bc.cacheConfig.StateDiffs {
+			state.TrackDiffs()
+		}
 		// Process block using the parent state as reference point.
 		receipts, logs, usedGas, err := bc.processor.Process(block, state, bc.vmConfig)
 		if err != nil {
@@ -1535,6 +1647,9 @@ func (bc *BlockChain) Config() *params.ChainConfig { return bc.chainConfig }
 // Engine retrieves the blockchain's consensus engine.
 func (bc *BlockChain) Engine() consensus.Engine { return bc.engine }
 
+// GetVMConfig returns the block chain VM config.
+func (bc *BlockChain) GetVMConfig() *vm.Config { return &bc.vmConfig }
+
 // SubscribeRemovedLogsEvent registers a subscription of RemovedLogsEvent.
 func (bc *BlockChain) SubscribeRemovedLogsEvent(ch chan<- RemovedLogsEvent) event.Subscription {
 	return bc.scope.Track(bc.rmLogsFeed.Subscribe(ch))
@@ -1344,3 +1344,155 @@ func TestLargeReorgTrieGC(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the flat state snapshot is maintained during block import, and it
+// is persisted on shutdown so that a restart can pick it up without having to
+// regenerate it.
+func TestSnapshotRestart(t *testing.T) {
+	engine := ethash.NewFaker()
+
+	db, _ := ethdb.NewMemDatabase()
+	genesis := new(Genesis).MustCommit(db)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 2*triesInMemory, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{byte(i)}) })
+
+	diskdb, _ := ethdb.NewMemDatabase()
+	new(Genesis).MustCommit(diskdb)
+
+	config := &CacheConfig{TrieNodeLimit: 256, TrieTimeLimit: 5 * time.Minute, Snapshot: true}
+	chain, err := NewBlockChain(diskdb, config, params.TestChainConfig, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if chain.stateCache.Snapshots().Snapshot(chain.CurrentBlock().Root()) == nil {
+		t.Fatalf("snapshot missing for head block")
+	}
+	chain.Stop()
+
+	if root, _ := diskdb.Get([]byte("SnapshotRoot")); common.BytesToHash(root) != blocks[triesInMemory].Root() {
+		t.Fatalf("persisted snapshot root mismatch: have %x, want %x", root, blocks[triesInMemory].Root())
+	}
+	// Restart the chain and ensure the snapshot is loaded for the repaired head
+	chain, err = NewBlockChain(diskdb, config, params.TestChainConfig, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to recreate tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if head, want := chain.CurrentBlock().NumberU64(), uint64(triesInMemory+1); head != want {
+		t.Fatalf("repaired head mismatch: have %d, want %d", head, want)
+	}
+	if chain.stateCache.Snapshots().Snapshot(chain.CurrentBlock().Root()) == nil {
+		t.Fatalf("snapshot not loaded after restart")
+	}
+	if _, err := chain.InsertChain(blocks[triesInMemory+1:]); err != nil {
+		t.Fatalf("failed to reimport chain: %v", err)
+	}
+	if chain.stateCache.Snapshots().Snapshot(chain.CurrentBlock().Root()) == nil {
+		t.Fatalf("snapshot missing for reimported head block")
+	}
+}
+
+// Tests that the state of blocks already pruned from a non-archive node can be
+// reconstructed from the stored reverse state diffs.
+func TestHistoricStateDiffs(t *testing.T) {
+	engine := ethash.NewFaker()
+
+	db, _ := ethdb.NewMemDatabase()
+	genesis := new(Genesis).MustCommit(db)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 2*triesInMemory, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{byte(i % 16)}) })
+
+	diskdb, _ := ethdb.NewMemDatabase()
+	new(Genesis).MustCommit(diskdb)
+
+	chain, err := NewBlockChain(diskdb, &CacheConfig{TrieNodeLimit: 256, TrieTimeLimit: 5 * time.Minute, StateDiffs: true}, params.TestChainConfig, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Ensure only block import tracks diffs, not other users of the state
+	statedb, _ := chain.State()
+	statedb.AddBalance(common.Address{0xff}, big.NewInt(1))
+	if _, err := statedb.Commit(false); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if diff := statedb.Diff(); diff != nil {
+		t.Errorf("state diff tracked outside of block import: %+v", diff)
+	}
+	for _, block := range []*types.Block{blocks[0], blocks[7], blocks[triesInMemory-1]} {
+		if chain.HasState(block.Root()) {
+			t.Fatalf("block #%d: state not pruned", block.NumberU64())
+		}
+		statedb, err := chain.HistoricState(block.Header())
+		if err != nil {
+			t.Fatalf("block #%d: failed to retrieve historic state: %v", block.NumberU64(), err)
+		}
+		if root := statedb.IntermediateRoot(false); root != block.Root() {
+			t.Fatalf("block #%d: historic state root mismatch: have %x, want %x", block.NumberU64(), root, block.Root())
+		}
+		want, _ := state.New(block.Root(), state.NewDatabase(db))
+		for i := byte(0); i < 16; i++ {
+			addr := common.Address{i}
+			if have, want := statedb.GetBalance(addr), want.GetBalance(addr); have.Cmp(want) != 0 {
+				t.Errorf("block #%d: balance mismatch for %x: have %v, want %v", block.NumberU64(), addr, have, want)
+			}
+		}
+	}
+	// Ensure a gap in the stored diffs is detected
+	DeleteStateDiff(diskdb, blocks[1].Hash(), blocks[1].NumberU64())
+	if _, err := chain.HistoricState(blocks[0].Header()); err == nil {
+		t.Fatalf("historic state retrieved without diff")
+	}
+}
+
+// Tests that historic states are only served within the configured rollback
+// limit and that the reverse state diffs beyond it are pruned.
+func TestHistoricStateLimit(t *testing.T) {
+	engine := ethash.NewFaker()
+
+	db, _ := ethdb.NewMemDatabase()
+	genesis := new(Genesis).MustCommit(db)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 2*triesInMemory, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{byte(i % 16)}) })
+
+	diskdb, _ := ethdb.NewMemDatabase()
+	new(Genesis).MustCommit(diskdb)
+
+	limit := uint64(triesInMemory + 8)
+	chain, err := NewBlockChain(diskdb, &CacheConfig{TrieNodeLimit: 256, TrieTimeLimit: 5 * time.Minute, StateDiffs: true, StateDiffLimit: limit}, params.TestChainConfig, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	head := blocks[len(blocks)-1].NumberU64()
+
+	// Ensure the state right at the limit is served, but not beyond
+	inside, outside := blocks[head-limit-1], blocks[head-limit-2]
+	if statedb, err := chain.HistoricState(inside.Header()); err != nil {
+		t.Fatalf("block #%d: failed to retrieve historic state: %v", inside.NumberU64(), err)
+	} else if root := statedb.IntermediateRoot(false); root != inside.Root() {
+		t.Fatalf("block #%d: historic state root mismatch: have %x, want %x", inside.NumberU64(), root, inside.Root())
+	}
+	if _, err := chain.HistoricState(outside.Header()); err == nil {
+		t.Fatalf("block #%d: historic state retrieved beyond the rollback limit", outside.NumberU64())
+	}
+	// Ensure the diffs not needed any more are pruned
+	for _, block := range blocks {
+		diff := GetStateDiff(diskdb, block.Hash(), block.NumberU64())
+		if block.NumberU64()+limit > head && diff == nil {
+			t.Errorf("block #%d: state diff missing within the rollback limit", block.NumberU64())
+		}
+		if block.NumberU64()+limit <= head && diff != nil {
+			t.Errorf("block #%d: state diff not pruned beyond the rollback limit", block.NumberU64())
+		}
+	}
+}
@@ -234,7 +234,7 @@ func makeHeader(chain consensus.ChainReader, parent *types.Block, state *state.S
 			Difficulty: parent.Difficulty(),
 			UncleHash:  parent.UncleHash(),
 		}),
-		GasLimit: CalcGasLimit(parent),
+		GasLimit: CalcGasLimit(parent, params.GenesisGasLimit, 0),
 		Number:   new(big.Int).Add(parent.Number(), common.Big1),
 		Time:     time,
 	}
@@ -24,6 +24,15 @@ import (
 // TxPreEvent is posted when a transaction enters the transaction pool.
 type TxPreEvent struct{ Tx *types.Transaction }
 
+// TxLifecycleEvent is posted when a transaction changes state within the
+// transaction pool. Replaced is set for TxReplaced, Reason for TxDropped.
+type TxLifecycleEvent struct {
+	Hash     common.Hash
+	Kind     TxLifecycle
+	Replaced common.Hash
+	Reason   TxDropReason
+}
+
 // PendingLogsEvent is posted pre mining and notifies of pending logs.
 type PendingLogsEvent struct {
 	Logs []*types.Log
@@ -0,0 +1,468 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// freezerHeaderTable indicates the name of the freezer header table.
+	freezerHeaderTable = "headers"
+
+	// freezerHashTable indicates the name of the freezer canonical hash table.
+	freezerHashTable = "hashes"
+
+	// freezerBodiesTable indicates the name of the freezer block body table.
+	freezerBodiesTable = "bodies"
+
+	// freezerReceiptTable indicates the name of the freezer receipts table.
+	freezerReceiptTable = "receipts"
+
+	// freezerDifficultyTable indicates the name of the freezer total difficulty table.
+	freezerDifficultyTable = "diffs"
+)
+
+// errReadOnly is returned if an attempt is made to modify a freezer opened in
+// read only mode.
+var errReadOnly = errors.New("read only")
+
+// freezerNoSnappy configures whether compression is disabled for the ancient
+// tables. Hashes and difficulties don't compress well.
+var freezerNoSnappy = map[string]bool{
+	freezerHeaderTable:     false,
+	freezerHashTable:       true,
+	freezerBodiesTable:     false,
+	freezerReceiptTable:    false,
+	freezerDifficultyTable: true,
+}
+
+const (
+	// freezerRecheckInterval is the frequency to check the key-value database for
+	// chain progression that might permit new blocks to be frozen into immutable
+	// storage.
+	freezerRecheckInterval = time.Minute
+
+	// freezerBatchLimit is the maximum number of blocks to freeze in one batch
+	// before doing an fsync and deleting it from the key-value store.
+	freezerBatchLimit = 30000
+)
+
+// DefaultImmutabilityThreshold is the number of blocks after which a chain
+// segment is considered immutable (i.e. soft finality) and may be moved out
+// of the key-value store into the ancient freezer.
+const DefaultImmutabilityThreshold = 90000
+
+// AncientReader contains the methods required to read from immutable ancient
+// chain data.
+type AncientReader interface {
+	// Ancient retrieves an ancient binary blob from the append-only immutable files.
+	Ancient(kind string, number uint64) ([]byte, error)
+
+	// Ancients returns the number of ancient items in the freezer.
+	Ancients() uint64
+}
+
+// AncientStore contains the methods required to read from and to discard data
+// from the immutable ancient chain data.
+type AncientStore interface {
+	AncientReader
+
+	// TruncateAncients discards all but the first n ancient items.
+	TruncateAncients(n uint64) error
+}
+
+// freezer is an append-only database to store immutable chain data into flat
+// files. The append only nature ensures that disk writes are minimized, and the
+// flat files neither need the periodic compaction of the key-value store, nor
+// do they amplify the storage cost of the chain over time.
+type freezer struct {
+	frozen    uint64 // Number of blocks already frozen, accessed atomically
+	threshold uint64 // Number of recent blocks not to freeze
+	readonly  bool   // Whether to reject any modification of the frozen data
+
+	tables map[string]*freezerTable // Data tables for storing everything
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newFreezer creates a chain freezer that moves ancient chain data into
+// append-only flat file containers.
+func newFreezer(datadir string, threshold uint64, readonly bool) (*freezer, error) {
+	freezer := &freezer{
+		threshold: threshold,
+		readonly:  readonly,
+		tables:    make(map[string]*freezerTable),
+		quit:      make(chan struct{}),
+	}
+	for name, noComp := range freezerNoSnappy {
+		table, err := newFreezerTable(datadir, name, noComp)
+		if err != nil {
+			for _, table := range freezer.tables {
+				table.Close()
+			}
+			return nil, err
+		}
+		freezer.tables[name] = table
+	}
+	if err := freezer.repair(); err != nil {
+		freezer.close()
+		return nil, err
+	}
+	log.Info("Opened ancient database", "database", datadir, "frozen", freezer.frozen, "readonly", readonly)
+	return freezer, nil
+}
+
+// repair truncates all data tables to the same length, dropping any items only
+// partially frozen by an unclean shutdown. Read only freezers leave the tables
+// untouched and only expose the items present in all of them.
+func (f *freezer) repair() error {
+	min := uint64(math.MaxUint64)
+	for _, table := range f.tables {
+		if items := table.Items(); items < min {
+			min = items
+		}
+	}
+	if f.readonly {
+		atomic.StoreUint64(&f.frozen, min)
+		return nil
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(min); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, min)
+	return nil
+}
+
+// Ancient retrieves an ancient binary blob from the append-only immutable files.
+func (f *freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.Retrieve(number)
+	}
+	return nil, fmt.Errorf("unknown ancient table %q", kind)
+}
+
+// Ancients returns the length of the frozen items.
+func (f *freezer) Ancients() uint64 {
+	return atomic.LoadUint64(&f.frozen)
+}
+
+// appendAncient injects all binary blobs belong to block at the end of the
+// append-only immutable table files.
+//
+// Notably, this function is lock free but kind of thread-safe. All out-of-order
+// injection will be rejected. But if two injections with same number happen at
+// the same time, we can get into the trouble.
+func (f *freezer) appendAncient(number uint64, hash, header, body, receipts, td []byte) error {
+	// Ensure the binary blobs we are appending are continuous with freezer.
+	if atomic.LoadUint64(&f.frozen) != number {
+		return errOutOrderInsertion
+	}
+	// Inject all the components into the relevant data tables, rolling back
+	// any partial insertion on failure
+	blobs := map[string][]byte{
+		freezerHashTable:       hash,
+		freezerHeaderTable:     header,
+		freezerBodiesTable:     body,
+		freezerReceiptTable:    receipts,
+		freezerDifficultyTable: td,
+	}
+	for kind, blob := range blobs {
+		if err := f.tables[kind].Append(number, blob); err != nil {
+			log.Error("Failed to append ancient item", "kind", kind, "number", number, "err", err)
+			f.TruncateAncients(number)
+			return err
+		}
+	}
+	atomic.AddUint64(&f.frozen, 1) // Only modify atomically
+	return nil
+}
+
+// TruncateAncients discards any recent data above the provided threshold number.
+func (f *freezer) TruncateAncients(items uint64) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(items); err != nil {
+			return err
+		}
+	}
+	if atomic.LoadUint64(&f.frozen) > items {
+		atomic.StoreUint64(&f.frozen, items)
+	}
+	return nil
+}
+
+// sync flushes all data tables to disk.
+func (f *freezer) sync() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// close terminates the background migrator and closes all data tables.
+func (f *freezer) close() error {
+	select {
+	case <-f.quit:
+	default:
+		close(f.quit)
+	}
+	f.wg.Wait()
+
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// freeze is a background thread that periodically checks the blockchain for any
+// import progress and moves ancient data from the fast database into the freezer.
+//
+// This functionality is deliberately broken off from block importing to avoid
+// incurring additional data shuffling delays on block propagation.
+func (f *freezer) freeze(db ethdb.Database) {
+	defer f.wg.Done()
+
+	backoff := false
+	for {
+		select {
+		case <-f.quit:
+			log.Info("Freezer shutting down")
+			return
+		default:
+		}
+		if backoff {
+			select {
+			case <-time.NewTimer(freezerRecheckInterval).C:
+				backoff = false
+			case <-f.quit:
+				return
+			}
+		}
+		// Retrieve the freezing threshold
+		hash := GetHeadBlockHash(db)
+		if hash == (common.Hash{}) {
+			log.Debug("Current full block hash unavailable") // new chain, empty database
+			backoff = true
+			continue
+		}
+		number := GetBlockNumber(db, hash)
+		switch {
+		case number == missingNumber:
+			log.Error("Current full block number unavailable", "hash", hash)
+			backoff = true
+			continue
+
+		case number < f.threshold:
+			log.Debug("Current full block not old enough", "number", number, "hash", hash, "delay", f.threshold)
+			backoff = true
+			continue
+
+		case number-f.threshold <= f.Ancients():
+			log.Debug("Ancient blocks frozen already", "number", number, "hash", hash, "frozen", f.Ancients())
+			backoff = true
+			continue
+		}
+		// Seems we have data ready to be frozen, process in usable batches
+		limit := number - f.threshold
+		if limit-f.Ancients() > freezerBatchLimit {
+			limit = f.Ancients() + freezerBatchLimit
+		}
+		var (
+			start    = time.Now()
+			first    = f.Ancients()
+			ancients = make([]common.Hash, 0, limit-first)
+		)
+		for f.Ancients() < limit {
+			// Retrieves all the components of the canonical block
+			number := f.Ancients()
+
+			hash := GetCanonicalHash(db, number)
+			if hash == (common.Hash{}) {
+				log.Error("Canonical hash missing, can't freeze", "number", number)
+				break
+			}
+			header := GetHeaderRLP(db, hash, number)
+			if len(header) == 0 {
+				log.Error("Block header missing, can't freeze", "number", number, "hash", hash)
+				break
+			}
+			body := GetBodyRLP(db, hash, number)
+			if len(body) == 0 {
+				log.Error("Block body missing, can't freeze", "number", number, "hash", hash)
+				break
+			}
+			receipts, _ := db.Get(blockReceiptsKey(hash, number))
+			if len(receipts) == 0 {
+				log.Error("Block receipts missing, can't freeze", "number", number, "hash", hash)
+				break
+			}
+			td, _ := db.Get(tdKey(hash, number))
+			if len(td) == 0 {
+				log.Error("Total difficulty missing, can't freeze", "number", number, "hash", hash)
+				break
+			}
+			// Inject all the components into the relevant data tables
+			if err := f.appendAncient(number, hash[:], header, body, receipts, td); err != nil {
+				break
+			}
+			ancients = append(ancients, hash)
+		}
+		// Batch of blocks have been frozen, flush them before wiping from the
+		// key-value store
+		if err := f.sync(); err != nil {
+			log.Crit("Failed to flush frozen tables", "err", err)
+		}
+		// Wipe out all data from the active database, keeping the canonical hash
+		// and number mappings around for lookups
+		batch := db.NewBatch()
+		for i, hash := range ancients {
+			number := first + uint64(i)
+
+			batch.Delete(headerKey(hash, number))
+			batch.Delete(blockBodyKey(hash, number))
+			batch.Delete(blockReceiptsKey(hash, number))
+			batch.Delete(tdKey(hash, number))
+
+			if batch.ValueSize() >= ethdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					log.Crit("Failed to delete frozen canonical blocks", "err", err)
+				}
+				batch.Reset()
+			}
+		}
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to delete frozen canonical blocks", "err", err)
+		}
+		// Log something friendly for the user
+		context := []interface{}{
+			"blocks", f.Ancients() - first, "elapsed", common.PrettyDuration(time.Since(start)), "number", f.Ancients() - 1,
+		}
+		if n := len(ancients); n > 0 {
+			context = append(context, []interface{}{"hash", ancients[n-1]}...)
+		}
+		log.Info("Deep froze chain segment", context...)
+
+		// Avoid database thrashing with tiny writes
+		if f.Ancients()-first < freezerBatchLimit {
+			backoff = true
+		}
+	}
+}
+
+// isAncient reports whether the block with the given hash and number was
+// already moved into the ancient freezer of the database, if it has one.
+func isAncient(db DatabaseReader, hash common.Hash, number uint64) bool {
+	reader, ok := db.(AncientReader)
+	if !ok || number >= reader.Ancients() {
+		return false
+	}
+	stored, err := reader.Ancient(freezerHashTable, number)
+	return err == nil && common.BytesToHash(stored) == hash
+}
+
+// readAncient retrieves the ancient data of the given kind belonging to the
+// canonical block with the given hash and number, if the database holds
+// frozen chain data and the block was already moved into it.
+func readAncient(db DatabaseReader, kind string, hash common.Hash, number uint64) rlp.RawValue {
+	if !isAncient(db, hash, number) {
+		return nil
+	}
+	data, _ := db.(AncientReader).Ancient(kind, number)
+	return data
+}
+
+// freezerdb is a database wrapper that enables freezer data retrievals.
+type freezerdb struct {
+	ethdb.Database
+	*freezer
+}
+
+// NewDatabaseWithFreezer creates a high level database on top of a given key-
+// value data store with a freezer moving immutable chain segments into cold
+// storage in the given directory. Blocks older than the threshold counted from
+// the current head are migrated by a background thread.
+func NewDatabaseWithFreezer(db ethdb.Database, datadir string, threshold uint64) (ethdb.Database, error) {
+	frdb, err := newFreezer(datadir, threshold, false)
+	if err != nil {
+		return nil, err
+	}
+	frdb.wg.Add(1)
+	go frdb.freeze(db)
+
+	return &freezerdb{
+		Database: db,
+		freezer:  frdb,
+	}, nil
+}
+
+// NewDatabaseWithReadOnlyFreezer creates a high level database on top of a given
+// key-value data store, retrieving ancient chain segments from the freezer in
+// the given directory. Unlike NewDatabaseWithFreezer, no chain data is moved out
+// of the key-value store and the frozen data is never discarded, so offline
+// tools can use it without altering the layout of the node's database.
+func NewDatabaseWithReadOnlyFreezer(db ethdb.Database, datadir string) (ethdb.Database, error) {
+	frdb, err := newFreezer(datadir, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	return &freezerdb{
+		Database: db,
+		freezer:  frdb,
+	}, nil
+}
+
+// KeyValueStore returns the key-value store holding the recent chain data.
+func (frdb *freezerdb) KeyValueStore() ethdb.Database {
+	return frdb.Database
+}
+
+// Close implements ethdb.Database, terminating the freezer before closing the
+// underlying key-value store.
+func (frdb *freezerdb) Close() {
+	if err := frdb.freezer.close(); err != nil {
+		log.Error("Failed to close ancient database", "err", err)
+	}
+	frdb.Database.Close()
+}
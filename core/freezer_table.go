@@ -0,0 +1,283 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/golang/snappy"
+)
+
+var (
+	// errOutOfBounds is returned if the item requested is not contained within
+	// the freezer table.
+	errOutOfBounds = errors.New("out of bounds")
+
+	// errOutOrderInsertion is returned if the user attempts to inject out-of-order
+	// binary blobs into the freezer.
+	errOutOrderInsertion = errors.New("the append operation is out-order")
+
+	// errClosed is returned if an operation attempts to use a closed freezer.
+	errClosed = errors.New("closed")
+)
+
+// indexEntrySize is the size of a single entry in the index file of a freezer
+// table, holding the end offset of the corresponding item in the data file.
+const indexEntrySize = 8
+
+// freezerTable is an append-only flat file table storing sequentially numbered
+// binary blobs. It consists of a data file holding the concatenated items and
+// an index file holding the end offset of each item within the data file.
+type freezerTable struct {
+	index   *os.File // File descriptor for the item offset index
+	data    *os.File // File descriptor for the concatenated item data
+	noComp  bool     // Whether to skip snappy compression of the items
+	items   uint64   // Number of items stored in the table
+	size    uint64   // Total size of the data file
+	logger  log.Logger
+	lock    sync.RWMutex
+	scratch [indexEntrySize]byte
+}
+
+// newFreezerTable opens the given freezer table, creating it if it doesn't exist
+// yet and repairing any inconsistency between the index and data files left by
+// an unclean shutdown.
+func newFreezerTable(path, name string, noComp bool) (*freezerTable, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	suffix := "cdat"
+	if noComp {
+		suffix = "rdat"
+	}
+	index, err := os.OpenFile(filepath.Join(path, name+".ridx"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.OpenFile(filepath.Join(path, fmt.Sprintf("%s.%s", name, suffix)), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	tab := &freezerTable{
+		index:  index,
+		data:   data,
+		noComp: noComp,
+		logger: log.New("table", name),
+	}
+	if err := tab.repair(); err != nil {
+		tab.Close()
+		return nil, err
+	}
+	return tab, nil
+}
+
+// repair cross checks the index and data files and truncates them to the last
+// item fully contained in both.
+func (t *freezerTable) repair() error {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	indexSize := stat.Size() - stat.Size()%indexEntrySize
+
+	if stat, err = t.data.Stat(); err != nil {
+		return err
+	}
+	dataSize := uint64(stat.Size())
+
+	// Drop any index entries pointing beyond the end of the data file
+	items := uint64(indexSize / indexEntrySize)
+	for ; items > 0; items-- {
+		end, err := t.offset(items - 1)
+		if err != nil {
+			return err
+		}
+		if end <= dataSize {
+			dataSize = end
+			break
+		}
+	}
+	if items == 0 {
+		dataSize = 0
+	}
+	if err := t.index.Truncate(int64(items * indexEntrySize)); err != nil {
+		return err
+	}
+	if err := t.data.Truncate(int64(dataSize)); err != nil {
+		return err
+	}
+	t.items, t.size = items, dataSize
+
+	t.logger.Debug("Opened freezer table", "items", t.items, "size", t.size)
+	return nil
+}
+
+// offset reads the end offset of the given item from the index file.
+func (t *freezerTable) offset(item uint64) (uint64, error) {
+	var buf [indexEntrySize]byte
+	if _, err := t.index.ReadAt(buf[:], int64(item*indexEntrySize)); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// Items returns the number of items stored in the table.
+func (t *freezerTable) Items() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.items
+}
+
+// Append injects a binary blob at the end of the freezer table. The item number
+// must be the next one in sequence, otherwise the append is rejected.
+func (t *freezerTable) Append(item uint64, blob []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if item != t.items {
+		return errOutOrderInsertion
+	}
+	if !t.noComp {
+		blob = snappy.Encode(nil, blob)
+	}
+	if _, err := t.data.WriteAt(blob, int64(t.size)); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint64(t.scratch[:], t.size+uint64(len(blob)))
+	if _, err := t.index.WriteAt(t.scratch[:], int64(t.items*indexEntrySize)); err != nil {
+		return err
+	}
+	t.items++
+	t.size += uint64(len(blob))
+	return nil
+}
+
+// Retrieve looks up the data offset of an item with the given number and
+// retrieves the raw binary blob from the data file.
+func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil {
+		return nil, errClosed
+	}
+	if item >= t.items {
+		return nil, errOutOfBounds
+	}
+	var start uint64
+	if item > 0 {
+		offset, err := t.offset(item - 1)
+		if err != nil {
+			return nil, err
+		}
+		start = offset
+	}
+	end, err := t.offset(item)
+	if err != nil {
+		return nil, err
+	}
+	if end < start || end > t.size {
+		return nil, fmt.Errorf("corrupt index entry %d: [%d, %d)", item, start, end)
+	}
+	blob := make([]byte, end-start)
+	if _, err := t.data.ReadAt(blob, int64(start)); err != nil {
+		return nil, err
+	}
+	if t.noComp {
+		return blob, nil
+	}
+	return snappy.Decode(nil, blob)
+}
+
+// truncate discards any recent data above the provided threshold number.
+func (t *freezerTable) truncate(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if t.items <= items {
+		return nil
+	}
+	var size uint64
+	if items > 0 {
+		end, err := t.offset(items - 1)
+		if err != nil {
+			return err
+		}
+		size = end
+	}
+	if err := t.index.Truncate(int64(items * indexEntrySize)); err != nil {
+		return err
+	}
+	if err := t.data.Truncate(int64(size)); err != nil {
+		return err
+	}
+	t.logger.Warn("Truncated freezer table", "items", t.items, "limit", items)
+	t.items, t.size = items, size
+	return nil
+}
+
+// Sync pushes any pending data from memory out to disk.
+func (t *freezerTable) Sync() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if err := t.data.Sync(); err != nil {
+		return err
+	}
+	return t.index.Sync()
+}
+
+// Close closes all opened files.
+func (t *freezerTable) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var errs []error
+	if t.index != nil {
+		if err := t.index.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if t.data != nil {
+		if err := t.data.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	t.index, t.data = nil, nil
+
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that items appended to a freezer table can be retrieved, survive a
+// reopen, and that the table repairs itself after a partial write.
+func TestFreezerTableAppendRepair(t *testing.T) {
+	for _, noComp := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "freezer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		table, err := newFreezerTable(dir, "test", noComp)
+		if err != nil {
+			t.Fatalf("failed to open table: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			if err := table.Append(uint64(i), bytes.Repeat([]byte{byte(i)}, i)); err != nil {
+				t.Fatalf("item %d: failed to append: %v", i, err)
+			}
+		}
+		if err := table.Append(200, []byte{0x01}); err != errOutOrderInsertion {
+			t.Fatalf("out of order append error mismatch: have %v, want %v", err, errOutOrderInsertion)
+		}
+		// Corrupt the tail of the index and ensure reopening drops the item
+		table.index.WriteAt([]byte{0x01, 0x02, 0x03}, 100*indexEntrySize)
+		table.Close()
+
+		if table, err = newFreezerTable(dir, "test", noComp); err != nil {
+			t.Fatalf("failed to reopen table: %v", err)
+		}
+		if items := table.Items(); items != 100 {
+			t.Fatalf("item count mismatch after repair: have %d, want %d", items, 100)
+		}
+		for i := 0; i < 100; i++ {
+			blob, err := table.Retrieve(uint64(i))
+			if err != nil {
+				t.Fatalf("item %d: failed to retrieve: %v", i, err)
+			}
+			if !bytes.Equal(blob, bytes.Repeat([]byte{byte(i)}, i)) {
+				t.Fatalf("item %d: content mismatch: have %x", i, blob)
+			}
+		}
+		if _, err := table.Retrieve(100); err != errOutOfBounds {
+			t.Fatalf("out of bounds error mismatch: have %v, want %v", err, errOutOfBounds)
+		}
+		// Truncate the table and ensure it can be appended to again
+		if err := table.truncate(50); err != nil {
+			t.Fatalf("failed to truncate table: %v", err)
+		}
+		if err := table.Append(50, []byte{0xff}); err != nil {
+			t.Fatalf("failed to append after truncation: %v", err)
+		}
+		if blob, _ := table.Retrieve(50); !bytes.Equal(blob, []byte{0xff}) {
+			t.Fatalf("content mismatch after truncation: have %x, want %x", blob, []byte{0xff})
+		}
+		table.Close()
+	}
+}
+
+// Tests that the freezer moves the ancient chain segment out of the key-value
+// store and that the chain accessors transparently retrieve it from there.
+func TestFreezerMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Create a chain with some transactions to have non empty receipts
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{address: {Balance: big.NewInt(1000000000)}}}
+		signer  = types.NewEIP155Signer(params.TestChainConfig.ChainId)
+	)
+	db, _ := ethdb.NewMemDatabase()
+	genesis := gspec.MustCommit(db)
+	blocks, receipts := GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 16, func(i int, b *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), common.Address{0xaa}, big.NewInt(1), params.TxGas, nil, nil), signer, key)
+		b.AddTx(tx)
+	})
+	chain, _ := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	chain.Stop()
+
+	// Open the freezer on top and wait for it to migrate the ancient blocks. The
+	// frozen count is bumped before the key-value data is wiped, so wait for the
+	// last frozen block to be deleted too.
+	frdb, err := NewDatabaseWithFreezer(db, dir, 4)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	defer frdb.Close()
+
+	last := blocks[10]
+	for start := time.Now(); ; {
+		present, _ := db.Has(headerKey(last.Hash(), last.NumberU64()))
+		if frdb.(AncientReader).Ancients() >= 12 && !present {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("ancient blocks not migrated: have %d, want %d", frdb.(AncientReader).Ancients(), 12)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i, block := range append([]*types.Block{genesis}, blocks...) {
+		hash, number := block.Hash(), block.NumberU64()
+
+		// Ensure the frozen blocks are gone from the key-value store
+		if ok, _ := db.Has(headerKey(hash, number)); ok != (number >= 12) {
+			t.Errorf("block %d: key-value header presence mismatch: have %v, want %v", number, ok, number >= 12)
+		}
+		// Ensure all the chain data is accessible through the freezer database
+		if stored := GetBlock(frdb, hash, number); stored == nil || stored.Hash() != hash {
+			t.Errorf("block %d: block mismatch: have %v", number, stored)
+		}
+		if td := GetTd(frdb, hash, number); td == nil {
+			t.Errorf("block %d: total difficulty missing", number)
+		}
+		if i > 0 {
+			if stored := GetBlockReceipts(frdb, hash, number); len(stored) != len(receipts[i-1]) {
+				t.Errorf("block %d: receipt count mismatch: have %d, want %d", number, len(stored), len(receipts[i-1]))
+			}
+		}
+		if GetBlock(frdb, common.Hash{0x01}, number) != nil {
+			t.Errorf("block %d: non-canonical hash resolved", number)
+		}
+	}
+}
+
+// Tests that a read only freezer exposes the already frozen chain segment, but
+// neither migrates any further blocks nor discards frozen ones.
+func TestFreezerReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, _ := ethdb.NewMemDatabase()
+	genesis := new(Genesis).MustCommit(db)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 16, nil)
+	chain, _ := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	chain.Stop()
+
+	// Freeze part of the chain, then shut the migrator down
+	f, err := newFreezer(dir, 12, false)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	f.wg.Add(1)
+	go f.freeze(db)
+	for start := time.Now(); f.Ancients() < 4; {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("ancient blocks not migrated: have %d, want %d", f.Ancients(), 4)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := f.close(); err != nil {
+		t.Fatalf("failed to close freezer: %v", err)
+	}
+	// Reopen it read only and ensure nothing changes
+	frdb, err := NewDatabaseWithReadOnlyFreezer(db, dir)
+	if err != nil {
+		t.Fatalf("failed to open read only freezer: %v", err)
+	}
+	defer frdb.Close()
+
+	if err := frdb.(AncientStore).TruncateAncients(0); err != errReadOnly {
+		t.Errorf("truncation error mismatch: have %v, want %v", err, errReadOnly)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if frozen := frdb.(AncientReader).Ancients(); frozen != 4 {
+		t.Errorf("frozen items mismatch: have %d, want %d", frozen, 4)
+	}
+	for _, block := range append([]*types.Block{genesis}, blocks...) {
+		hash, number := block.Hash(), block.NumberU64()
+
+		if ok, _ := db.Has(headerKey(hash, number)); ok != (number >= 4) {
+			t.Errorf("block %d: key-value header presence mismatch: have %v, want %v", number, ok, number >= 4)
+		}
+		if stored := GetBlock(frdb, hash, number); stored == nil || stored.Hash() != hash {
+			t.Errorf("block %d: block mismatch: have %v", number, stored)
+		}
+	}
+}
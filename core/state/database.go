@@ -21,6 +21,7 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/trie"
 	lru "github.com/hashicorp/golang-lru"
@@ -57,6 +58,10 @@ type Database interface {
 
 	// TrieDB retrieves the low level trie database used for data storage.
 	TrieDB() *trie.Database
+
+	// Snapshots retrieves the flat state snapshot tree serving account and
+	// storage reads, or nil if snapshots are not maintained.
+	Snapshots() *snapshot.Tree
 }
 
 // Trie is a Ethereum Merkle Trie.
@@ -83,8 +88,20 @@ func NewDatabase(db ethdb.Database) Database {
 	}
 }
 
+// NewDatabaseWithSnapshots creates a backing store for state which, on top of
+// NewDatabase, maintains flat snapshots of the given state root and all states
+// committed on top of it. Reads are served from the snapshots when available,
+// falling back to the tries otherwise. The snapshot of the root is loaded from
+// the database, or generated in the background if missing.
+func NewDatabaseWithSnapshots(db ethdb.Database, root common.Hash) Database {
+	sdb := NewDatabase(db).(*cachingDB)
+	sdb.snaps = snapshot.New(db, sdb.db, root)
+	return sdb
+}
+
 type cachingDB struct {
 	db            *trie.Database
+	snaps         *snapshot.Tree
 	mu            sync.Mutex
 	pastTries     []*trie.SecureTrie
 	codeSizeCache *lru.Cache
@@ -162,6 +179,11 @@ func (db *cachingDB) TrieDB() *trie.Database {
 	return db.db
 }
 
+// Snapshots retrieves the flat state snapshot tree, if one is maintained.
+func (db *cachingDB) Snapshots() *snapshot.Tree {
+	return db.snaps
+}
+
 // cachedTrie inserts its trie into a cachingDB on commit.
 type cachedTrie struct {
 	*trie.SecureTrie
@@ -0,0 +1,122 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// stateBloomHashes is the number of bits set in the bloom filter per entry.
+const stateBloomHashes = 4
+
+// stateBloom is a bloom filter used during state pruning to record all the trie
+// nodes and contract codes reachable from the retained state roots. As all the
+// inserted keys are already keccak hashes, the filter simply slices them up
+// instead of rehashing.
+//
+// False positives only mean that some stale data is kept in the database, they
+// never lead to live data being deleted.
+type stateBloom struct {
+	bits []byte
+}
+
+// newStateBloom creates a bloom filter with the given size in bytes.
+func newStateBloom(size uint64) *stateBloom {
+	return &stateBloom{bits: make([]byte, size)}
+}
+
+// index returns the bit position of the i-th hash of the given key.
+func (b *stateBloom) index(key []byte, i int) uint64 {
+	return binary.BigEndian.Uint64(key[i*8:]) % (uint64(len(b.bits)) * 8)
+}
+
+// add inserts a 32 byte hash key into the bloom filter.
+func (b *stateBloom) add(key []byte) {
+	for i := 0; i < stateBloomHashes; i++ {
+		idx := b.index(key, i)
+		b.bits[idx/8] |= 1 << (idx % 8)
+	}
+}
+
+// contains reports whether a 32 byte hash key might have been inserted.
+func (b *stateBloom) contains(key []byte) bool {
+	for i := 0; i < stateBloomHashes; i++ {
+		idx := b.index(key, i)
+		if b.bits[idx/8]&(1<<(idx%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomFile is the on-disk representation of a fully marked bloom filter,
+// along with the chain position it was generated for.
+type bloomFile struct {
+	Head  common.Hash   // Head block hash at the time of marking
+	Roots []common.Hash // State roots retained by the pruning
+	Bits  []byte        // Bloom filter of all reachable state entries
+}
+
+// writeBloom atomically persists a marked bloom filter to the given path.
+func writeBloom(path string, head common.Hash, roots []common.Hash, bloom *stateBloom) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := rlp.Encode(w, &bloomFile{Head: head, Roots: roots, Bits: bloom.bits}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readBloom loads a previously persisted bloom filter from the given path.
+func readBloom(path string) (common.Hash, []common.Hash, *stateBloom, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return common.Hash{}, nil, nil, err
+	}
+	defer f.Close()
+
+	var file bloomFile
+	if err := rlp.NewStream(bufio.NewReader(f), 0).Decode(&file); err != nil {
+		return common.Hash{}, nil, nil, err
+	}
+	if len(file.Bits) == 0 {
+		return common.Hash{}, nil, nil, errors.New("empty bloom filter")
+	}
+	return file.Head, file.Roots, &stateBloom{bits: file.Bits}, nil
+}
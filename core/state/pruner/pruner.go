@@ -0,0 +1,279 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pruner implements offline pruning of stale state trie nodes.
+package pruner
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	// bloomFileName is the name of the file holding the marked bloom filter
+	// while a pruning is in progress.
+	bloomFileName = "statebloom.bf"
+
+	// logInterval is the time between two progress reports.
+	logInterval = 8 * time.Second
+)
+
+// pruneProgressKey tracks the last database key swept by an in-progress pruning.
+var pruneProgressKey = []byte("StatePruneProgress")
+
+// Pruner is an offline tool to prune the stale state trie nodes from the
+// database. It marks every trie node and contract code reachable from the state
+// roots of the most recent blocks (and the genesis) in a bloom filter, and then
+// deletes every other state entry from the database in place.
+//
+// The bloom filter is persisted to disk before anything is deleted and the sweep
+// progress is checkpointed into the database, so an interrupted pruning resumes
+// where it left off when the pruner is run again.
+type Pruner struct {
+	db        ethdb.Database
+	bloomPath string // Path of the persisted bloom filter
+	bloomSize uint64 // Size of the bloom filter in bytes
+}
+
+// NewPruner creates a state pruner operating on the given database. The datadir
+// is used to persist the bloom filter while pruning, bloomSize is its size in
+// megabytes.
+func NewPruner(db ethdb.Database, datadir string, bloomSize uint64) (*Pruner, error) {
+	if bloomSize < 1 {
+		return nil, fmt.Errorf("bloom filter size too small: %d MB", bloomSize)
+	}
+	return &Pruner{
+		db:        db,
+		bloomPath: filepath.Join(datadir, bloomFileName),
+		bloomSize: bloomSize * 1024 * 1024,
+	}, nil
+}
+
+// Prune deletes all state entries not reachable from the state roots of the
+// most recent keep blocks whose state is available in the database. If an
+// interrupted pruning is found for the same chain head, it is resumed instead.
+func (p *Pruner) Prune(keep int) error {
+	if keep < 1 {
+		return fmt.Errorf("invalid number of states to retain: %d", keep)
+	}
+	head := core.GetHeadBlockHash(p.db)
+	if head == (common.Hash{}) {
+		return errors.New("head block missing")
+	}
+	// Resume any previous pruning if the chain didn't move in the meantime
+	bloom, roots, err := p.loadBloom(head)
+	if err != nil {
+		return err
+	}
+	if bloom == nil {
+		if roots, err = p.retainedRoots(head, keep); err != nil {
+			return err
+		}
+		if bloom, err = p.mark(roots); err != nil {
+			return err
+		}
+		if err := writeBloom(p.bloomPath, head, roots, bloom); err != nil {
+			return err
+		}
+	}
+	if err := p.sweep(bloom); err != nil {
+		return err
+	}
+	// Pruning done, clean up all the leftovers and compact the database
+	if err := p.db.Delete(pruneProgressKey); err != nil {
+		return err
+	}
+	if err := os.Remove(p.bloomPath); err != nil {
+		return err
+	}
+	kvdb := p.db
+	if frdb, ok := kvdb.(interface {
+		KeyValueStore() ethdb.Database
+	}); ok {
+		kvdb = frdb.KeyValueStore()
+	}
+	if db, ok := kvdb.(*ethdb.LDBDatabase); ok {
+		log.Info("Compacting database")
+		start := time.Now()
+		if err := db.LDB().CompactRange(util.Range{}); err != nil {
+			return err
+		}
+		log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return nil
+}
+
+// loadBloom loads the bloom filter of an interrupted pruning. If none exists or
+// it was generated for a different chain head, nil is returned and any partial
+// progress is discarded. This is safe as the previously retained states are a
+// subset of what's needed by any chain grown on top of them.
+func (p *Pruner) loadBloom(head common.Hash) (*stateBloom, []common.Hash, error) {
+	if !common.FileExist(p.bloomPath) {
+		return nil, nil, nil
+	}
+	marked, roots, bloom, err := readBloom(p.bloomPath)
+	if err != nil || marked != head {
+		log.Warn("Discarding stale pruning bloom filter", "path", p.bloomPath, "err", err)
+		if err := os.Remove(p.bloomPath); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, p.db.Delete(pruneProgressKey)
+	}
+	log.Info("Resuming interrupted state pruning", "roots", len(roots))
+	return bloom, roots, nil
+}
+
+// retainedRoots walks the chain backwards from the head, collecting the state
+// roots of the most recent keep blocks that have their state available. The
+// genesis state is always retained too.
+func (p *Pruner) retainedRoots(head common.Hash, keep int) ([]common.Hash, error) {
+	var (
+		roots  []common.Hash
+		seen   = make(map[common.Hash]bool)
+		header = core.GetHeader(p.db, head, core.GetBlockNumber(p.db, head))
+	)
+	for header != nil && len(roots) < keep {
+		if !seen[header.Root] && p.hasState(header.Root) {
+			log.Info("Retaining state", "number", header.Number, "hash", header.Hash(), "root", header.Root)
+			roots = append(roots, header.Root)
+			seen[header.Root] = true
+		}
+		if header.Number.Uint64() == 0 {
+			break
+		}
+		header = core.GetHeader(p.db, header.ParentHash, header.Number.Uint64()-1)
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("no recent state available to retain")
+	}
+	if genesis := core.GetHeader(p.db, core.GetCanonicalHash(p.db, 0), 0); genesis != nil {
+		if !seen[genesis.Root] && p.hasState(genesis.Root) {
+			roots = append(roots, genesis.Root)
+		}
+	}
+	return roots, nil
+}
+
+// hasState reports whether the root node of the given state trie is present in
+// the database. As tries are committed bottom up, this implies the full state.
+func (p *Pruner) hasState(root common.Hash) bool {
+	ok, _ := p.db.Has(root[:])
+	return ok
+}
+
+// mark iterates over all the given states and records every trie node and
+// contract code reachable from them in a fresh bloom filter.
+func (p *Pruner) mark(roots []common.Hash) (*stateBloom, error) {
+	var (
+		bloom  = newStateBloom(p.bloomSize)
+		sdb    = state.NewDatabase(p.db)
+		nodes  int
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for _, root := range roots {
+		statedb, err := state.New(root, sdb)
+		if err != nil {
+			return nil, err
+		}
+		it := state.NewNodeIterator(statedb)
+		for it.Next() {
+			if it.Hash == (common.Hash{}) {
+				continue
+			}
+			bloom.add(it.Hash[:])
+			nodes++
+
+			if time.Since(logged) > logInterval {
+				log.Info("Marking state entries", "root", root, "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+				logged = time.Now()
+			}
+		}
+		if it.Error != nil {
+			return nil, fmt.Errorf("state %x iteration failed: %v", root, it.Error)
+		}
+	}
+	log.Info("Marked retained state entries", "roots", len(roots), "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+	return bloom, nil
+}
+
+// sweep deletes all the trie nodes and contract codes from the database which
+// are not marked in the bloom filter, checkpointing the progress as it goes.
+func (p *Pruner) sweep(bloom *stateBloom) error {
+	start, _ := p.db.Get(pruneProgressKey)
+	if len(start) > 0 {
+		log.Info("Resuming state sweep", "from", common.ToHex(start))
+	}
+	var (
+		batch  = p.db.NewBatch()
+		it     = p.db.NewIteratorWithStart(start)
+		count  int
+		size   common.StorageSize
+		begin  = time.Now()
+		logged = time.Now()
+	)
+	defer it.Release()
+
+	for it.Next() {
+		// Trie nodes and contract codes are the only entries keyed by bare hashes
+		key := it.Key()
+		if len(key) != common.HashLength || bloom.contains(key) {
+			continue
+		}
+		count++
+		size += common.StorageSize(len(key) + len(it.Value()))
+		batch.Delete(key)
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			batch.Put(pruneProgressKey, common.CopyBytes(key))
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > logInterval {
+			log.Info("Pruning state data", "nodes", count, "size", size, "progress", progress(key), "elapsed", common.PrettyDuration(time.Since(begin)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Pruned state data", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(begin)))
+	return nil
+}
+
+// progress estimates the percentage of the hash keyspace already swept through,
+// relying on state keys being uniformly distributed.
+func progress(key []byte) string {
+	pos := float64(binary.BigEndian.Uint64(key[:8])) / math.MaxUint64
+	return fmt.Sprintf("%.2f%%", pos*100)
+}
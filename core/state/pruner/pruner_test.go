@@ -0,0 +1,160 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// newTestChain creates a database with a genesis and two blocks on top, the
+// second one overwriting all the storage slots set in the first. The state roots
+// of the genesis and the two blocks are returned.
+func newTestChain(t *testing.T) (*ethdb.MemDatabase, []common.Hash) {
+	db, _ := ethdb.NewMemDatabase()
+	genesis := (&core.Genesis{
+		Alloc: core.GenesisAlloc{common.Address{0x01}: {Balance: big.NewInt(1000000)}},
+	}).MustCommit(db)
+
+	var (
+		sdb    = state.NewDatabase(db)
+		roots  = []common.Hash{genesis.Root()}
+		parent = genesis.Header()
+	)
+	for i := 1; i <= 2; i++ {
+		statedb, _ := state.New(parent.Root, sdb)
+		for j := 0; j < 64; j++ {
+			addr := common.BytesToAddress([]byte{0x10, byte(j)})
+			statedb.AddBalance(addr, big.NewInt(int64(i)))
+			statedb.SetCode(addr, []byte{byte(i), byte(j)})
+			statedb.SetState(addr, common.Hash{byte(j)}, common.Hash{byte(i), byte(j)})
+		}
+		root, err := statedb.Commit(true)
+		if err != nil {
+			t.Fatalf("block %d: failed to commit state: %v", i, err)
+		}
+		if err := sdb.TrieDB().Commit(root, false); err != nil {
+			t.Fatalf("block %d: failed to flush state: %v", i, err)
+		}
+		header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(int64(i)), Root: root, Difficulty: big.NewInt(1)}
+		core.WriteHeader(db, header)
+		core.WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+		core.WriteHeadBlockHash(db, header.Hash())
+
+		roots, parent = append(roots, root), header
+	}
+	return db, roots
+}
+
+// checkState iterates over the entire state, failing if any data is missing.
+func checkState(t *testing.T, db ethdb.Database, root common.Hash) {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("state %x: failed to open: %v", root, err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("state %x: iteration failed: %v", root, it.Error)
+	}
+}
+
+// Tests that pruning retains the recent and genesis states, but deletes all the
+// state data only referenced by older states.
+func TestPrune(t *testing.T) {
+	db, roots := newTestChain(t)
+
+	datadir, err := ioutil.TempDir("", "pruner-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary datadir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	pruner, err := NewPruner(db, datadir, 1)
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	size := db.Len()
+	if err := pruner.Prune(1); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	if db.Len() >= size {
+		t.Errorf("nothing pruned: have %d entries, had %d", db.Len(), size)
+	}
+	checkState(t, db, roots[0])
+	checkState(t, db, roots[2])
+
+	if ok, _ := db.Has(roots[1][:]); ok {
+		t.Errorf("stale state root %x not pruned", roots[1])
+	}
+	if common.FileExist(pruner.bloomPath) {
+		t.Errorf("bloom filter not cleaned up")
+	}
+	if ok, _ := db.Has(pruneProgressKey); ok {
+		t.Errorf("pruning progress marker not cleaned up")
+	}
+}
+
+// Tests that an interrupted pruning can be resumed from the persisted bloom
+// filter, and that a bloom filter of a different head is discarded.
+func TestPruneResume(t *testing.T) {
+	db, roots := newTestChain(t)
+
+	datadir, err := ioutil.TempDir("", "pruner-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary datadir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	pruner, _ := NewPruner(db, datadir, 1)
+
+	// Simulate a crash right after marking the two most recent states
+	bloom, err := pruner.mark(roots[1:])
+	if err != nil {
+		t.Fatalf("failed to mark state: %v", err)
+	}
+	if err := writeBloom(pruner.bloomPath, core.GetHeadBlockHash(db), roots[1:], bloom); err != nil {
+		t.Fatalf("failed to persist bloom: %v", err)
+	}
+	// Resuming should retain both marked states, even though only one is requested
+	if err := pruner.Prune(1); err != nil {
+		t.Fatalf("failed to resume pruning: %v", err)
+	}
+	checkState(t, db, roots[1])
+	checkState(t, db, roots[2])
+
+	// A bloom generated for a different head must be discarded and regenerated
+	if err := writeBloom(pruner.bloomPath, common.Hash{0xff}, roots[1:], bloom); err != nil {
+		t.Fatalf("failed to persist bloom: %v", err)
+	}
+	if err := pruner.Prune(1); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	checkState(t, db, roots[2])
+	if ok, _ := db.Has(roots[1][:]); ok {
+		t.Errorf("stale state root %x not pruned", roots[1])
+	}
+}
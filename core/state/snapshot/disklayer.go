@@ -0,0 +1,197 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// diskLayer is a low level persistent snapshot built on top of a key-value store.
+type diskLayer struct {
+	diskdb ethdb.Database // Key-value store containing the base snapshot
+	triedb *trie.Database // Trie node cache for reconstruction purposes
+	root   common.Hash    // Root hash of the base snapshot
+	stale  bool           // Signals that the layer became stale (state progressed)
+
+	genMarker []byte             // Marker for the state that's indexed during initial layer generation, nil if done
+	genAbort  chan chan struct{} // Notification channel to abort generating the snapshot in this layer
+	genDone   chan struct{}      // Channel closed when the generator of this layer terminates
+
+	lock sync.RWMutex
+}
+
+// newDiskLayer creates a disk layer for the given root, starting a background
+// generator if the snapshot is not yet complete.
+func newDiskLayer(diskdb ethdb.Database, triedb *trie.Database, root common.Hash, marker []byte) *diskLayer {
+	dl := &diskLayer{
+		diskdb:    diskdb,
+		triedb:    triedb,
+		root:      root,
+		genMarker: marker,
+	}
+	if marker != nil {
+		dl.genAbort = make(chan chan struct{})
+		dl.genDone = make(chan struct{})
+		go dl.generate()
+	}
+	return dl
+}
+
+// Root returns root hash for which this snapshot was made.
+func (dl *diskLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent always returns nil as there's no layer below the disk.
+func (dl *diskLayer) Parent() snapshot {
+	return nil
+}
+
+// Stale return whether this layer has become stale (was flattened across) or if
+// it's still live.
+func (dl *diskLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// covered reports whether the snapshot data of the given account was already
+// generated. The caller must hold the layer lock.
+func (dl *diskLayer) covered(accountHash common.Hash) bool {
+	return dl.genMarker == nil || bytes.Compare(accountHash[:], dl.genMarker) <= 0
+}
+
+// Account directly retrieves the account RLP associated with a particular
+// hash in the snapshot.
+func (dl *diskLayer) Account(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !dl.covered(hash) {
+		return nil, ErrNotCoveredYet
+	}
+	blob, _ := dl.diskdb.Get(accountKey(hash))
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	return blob, nil
+}
+
+// Storage directly retrieves the storage data associated with a particular hash,
+// within a particular account.
+func (dl *diskLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !dl.covered(accountHash) {
+		return nil, ErrNotCoveredYet
+	}
+	blob, _ := dl.diskdb.Get(storageKey(accountHash, storageHash))
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	return blob, nil
+}
+
+// stopGeneration aborts the background generator of the layer, if it's still
+// running, and waits for it to persist its progress.
+func (dl *diskLayer) stopGeneration() {
+	if dl.genAbort == nil {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case dl.genAbort <- done:
+		<-done
+	case <-dl.genDone:
+	}
+}
+
+// diffToDisk merges a bottom-most diff into the persistent disk layer underneath
+// it. The method returns a new disk layer, the old one is marked stale together
+// with the merged diff. Only the data already covered by a running generation is
+// written out, the rest will be picked up by the generator from the new root.
+func diffToDisk(base *diskLayer, bottom *diffLayer) (*diskLayer, error) {
+	base.stopGeneration()
+
+	base.lock.Lock()
+	defer base.lock.Unlock()
+
+	var (
+		batch  = base.diskdb.NewBatch()
+		marker = base.genMarker
+	)
+	// Delete all the destructed accounts along with their storage
+	for hash := range bottom.destructSet {
+		if !base.covered(hash) {
+			continue
+		}
+		batch.Delete(accountKey(hash))
+
+		it := base.diskdb.NewIteratorWithPrefix(storageKey(hash, common.Hash{})[:1+common.HashLength])
+		for it.Next() {
+			if key := it.Key(); len(key) == storageKeyLength {
+				batch.Delete(common.CopyBytes(key))
+			}
+		}
+		it.Release()
+	}
+	// Push all updated accounts and storage slots into the database
+	for hash, data := range bottom.accountData {
+		if !base.covered(hash) {
+			continue
+		}
+		batch.Put(accountKey(hash), data)
+	}
+	for accountHash, storage := range bottom.storageData {
+		if !base.covered(accountHash) {
+			continue
+		}
+		for storageHash, data := range storage {
+			if len(data) == 0 {
+				batch.Delete(storageKey(accountHash, storageHash))
+				continue
+			}
+			batch.Put(storageKey(accountHash, storageHash), data)
+		}
+	}
+	// Update the snapshot block marker and write any remainder data
+	batch.Put(snapshotRootKey, bottom.root[:])
+	if err := writeGeneratorMarker(batch, marker); err != nil {
+		return nil, err
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write snapshot data", "err", err)
+	}
+	base.stale = true
+	bottom.markStale()
+
+	return newDiskLayer(base.diskdb, base.triedb, bottom.root, marker), nil
+}
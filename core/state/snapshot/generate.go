@@ -0,0 +1,179 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// emptyRoot is the known root hash of an empty trie.
+var emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+// account is the consensus representation of an Ethereum account, duplicated
+// here to avoid a dependency on the state package.
+type account struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// generate is a background thread that iterates over the state trie of the disk
+// layer and writes the flat snapshot entries of all accounts and storage slots
+// into the database, checkpointing the progress in the generation marker. When
+// started from scratch, any leftover snapshot data is wiped first.
+func (dl *diskLayer) generate() {
+	defer close(dl.genDone)
+
+	var (
+		batch   = dl.diskdb.NewBatch()
+		start   = time.Now()
+		logged  = time.Now()
+		marker  = dl.genMarker
+		counted int
+	)
+	// checkpoint flushes the batch and publishes the new generation marker
+	checkpoint := func(marker []byte) bool {
+		if err := writeGeneratorMarker(batch, marker); err != nil {
+			log.Error("Failed to store snapshot marker", "err", err)
+			return false
+		}
+		if err := batch.Write(); err != nil {
+			log.Error("Failed to write snapshot data", "err", err)
+			return false
+		}
+		batch.Reset()
+
+		dl.lock.Lock()
+		dl.genMarker = marker
+		dl.lock.Unlock()
+		return true
+	}
+	// aborted checks whether the generation was requested to stop
+	aborted := func() chan struct{} {
+		select {
+		case done := <-dl.genAbort:
+			return done
+		default:
+			return nil
+		}
+	}
+	// Wipe any leftovers if the generation is starting from scratch
+	if len(marker) == 0 {
+		for _, prefix := range [][]byte{accountPrefix, storagePrefix} {
+			keylen := accountKeyLength
+			if bytes.Equal(prefix, storagePrefix) {
+				keylen = storageKeyLength
+			}
+			it := dl.diskdb.NewIteratorWithPrefix(prefix)
+			for it.Next() {
+				if key := it.Key(); len(key) == keylen {
+					batch.Delete(common.CopyBytes(key))
+				}
+				if batch.ValueSize() >= ethdb.IdealBatchSize {
+					if err := batch.Write(); err != nil {
+						log.Error("Failed to wipe snapshot data", "err", err)
+						it.Release()
+						return
+					}
+					batch.Reset()
+					if done := aborted(); done != nil {
+						it.Release()
+						close(done)
+						return
+					}
+				}
+			}
+			it.Release()
+		}
+		if err := batch.Write(); err != nil {
+			log.Error("Failed to wipe snapshot data", "err", err)
+			return
+		}
+		batch.Reset()
+	}
+	// Iterate over the account trie from the marker on
+	accTrie, err := trie.NewSecure(dl.root, dl.triedb, 0)
+	if err != nil {
+		log.Warn("Snapshot generation paused, state missing", "root", dl.root, "err", err)
+		return
+	}
+	accIt := trie.NewIterator(accTrie.NodeIterator(marker))
+	for accIt.Next() {
+		if len(marker) > 0 && bytes.Compare(accIt.Key, marker) <= 0 {
+			continue // The marker itself is already generated
+		}
+		var acc account
+		if err := rlp.DecodeBytes(accIt.Value, &acc); err != nil {
+			log.Crit("Invalid account encountered during snapshot creation", "err", err)
+		}
+		accountHash := common.BytesToHash(accIt.Key)
+		batch.Put(accountKey(accountHash), accIt.Value)
+
+		// Generate all the storage slots of the account too
+		if acc.Root != emptyRoot {
+			storeTrie, err := trie.NewSecure(acc.Root, dl.triedb, 0)
+			if err != nil {
+				log.Warn("Snapshot generation paused, storage missing", "root", acc.Root, "err", err)
+				return
+			}
+			storeIt := trie.NewIterator(storeTrie.NodeIterator(nil))
+			for storeIt.Next() {
+				batch.Put(storageKey(accountHash, common.BytesToHash(storeIt.Key)), storeIt.Value)
+				counted++
+			}
+			if storeIt.Err != nil {
+				log.Warn("Snapshot generation paused, storage missing", "root", acc.Root, "err", storeIt.Err)
+				return
+			}
+		}
+		counted++
+
+		// Checkpoint after a full account if aborted or the batch grew large enough
+		if done := aborted(); done != nil {
+			checkpoint(accountHash[:])
+			close(done)
+			return
+		}
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if !checkpoint(accountHash[:]) {
+				return
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Generating state snapshot", "at", accountHash, "entries", counted, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if accIt.Err != nil {
+		log.Warn("Snapshot generation paused, state missing", "root", dl.root, "err", accIt.Err)
+		return
+	}
+	// Snapshot fully generated, remove the marker
+	if !checkpoint(nil) {
+		return
+	}
+	log.Info("Generated state snapshot", "entries", counted, "elapsed", common.PrettyDuration(time.Since(start)))
+}
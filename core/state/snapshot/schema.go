@@ -0,0 +1,98 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// The fields below define the low level database schema of the snapshot. They
+// share the chain database, so the keys of the flat entries are chosen to never
+// collide with the 32 byte trie node keys.
+var (
+	// snapshotRootKey tracks the hash of the last snapshot persisted to disk.
+	snapshotRootKey = []byte("SnapshotRoot")
+
+	// snapshotGeneratorKey tracks the snapshot generation marker. It is absent if
+	// the generation has finished.
+	snapshotGeneratorKey = []byte("SnapshotGenerator")
+
+	accountPrefix = []byte("a") // accountPrefix + account hash -> account trie value
+	storagePrefix = []byte("o") // storagePrefix + account hash + storage hash -> storage trie value
+)
+
+const (
+	accountKeyLength = 1 + common.HashLength   // Length of an account snapshot key
+	storageKeyLength = 1 + 2*common.HashLength // Length of a storage snapshot key
+)
+
+// accountKey = accountPrefix + hash
+func accountKey(hash common.Hash) []byte {
+	return append(append([]byte{}, accountPrefix...), hash[:]...)
+}
+
+// storageKey = storagePrefix + account hash + storage hash
+func storageKey(accountHash, storageHash common.Hash) []byte {
+	key := append(append([]byte{}, storagePrefix...), accountHash[:]...)
+	return append(key, storageHash[:]...)
+}
+
+// readSnapshotRoot retrieves the root of the persisted snapshot.
+func readSnapshotRoot(db ethdb.Database) common.Hash {
+	data, _ := db.Get(snapshotRootKey)
+	if len(data) != common.HashLength {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// readGeneratorMarker retrieves the progress marker of the snapshot generation,
+// or nil if the snapshot was fully generated.
+func readGeneratorMarker(db ethdb.Database) []byte {
+	if ok, _ := db.Has(snapshotGeneratorKey); !ok {
+		return nil
+	}
+	marker, _ := db.Get(snapshotGeneratorKey)
+	if marker == nil {
+		marker = []byte{}
+	}
+	return marker
+}
+
+// writeGeneratorMarker stores the progress marker of the snapshot generation,
+// or deletes it if the generation is done.
+func writeGeneratorMarker(db interface {
+	ethdb.Putter
+	ethdb.Deleter
+}, marker []byte) error {
+	if marker == nil {
+		return db.Delete(snapshotGeneratorKey)
+	}
+	return db.Put(snapshotGeneratorKey, marker)
+}
+
+// writeSnapshotState atomically stores the root and generation marker of the
+// persisted snapshot.
+func writeSnapshotState(db ethdb.Database, root common.Hash, marker []byte) error {
+	batch := db.NewBatch()
+	batch.Put(snapshotRootKey, root[:])
+	if err := writeGeneratorMarker(batch, marker); err != nil {
+		return err
+	}
+	return batch.Write()
+}
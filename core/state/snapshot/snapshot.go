@@ -0,0 +1,258 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snapshot implements a flat journaled state snapshot, kept in sync
+// with block processing to accelerate account and storage reads.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	// ErrSnapshotStale is returned from data accessors if the underlying snapshot
+	// layer had been invalidated due to the chain progressing forward far enough
+	// to not maintain the layer's original state.
+	ErrSnapshotStale = errors.New("snapshot stale")
+
+	// ErrNotCoveredYet is returned from data accessors if the underlying snapshot
+	// is being generated currently and the requested data item is not yet in the
+	// range of accounts covered.
+	ErrNotCoveredYet = errors.New("not covered yet")
+
+	// errSnapshotCycle is returned if a snapshot is attempted to be inserted
+	// that forms a cycle in the snapshot tree.
+	errSnapshotCycle = errors.New("snapshot cycle")
+)
+
+// Snapshot represents the functionality supported by a snapshot storage layer.
+type Snapshot interface {
+	// Root returns the root hash for which this snapshot was made.
+	Root() common.Hash
+
+	// Account directly retrieves the RLP encoded account associated with a
+	// particular hash in the snapshot. A nil result means the account doesn't
+	// exist.
+	Account(hash common.Hash) ([]byte, error)
+
+	// Storage directly retrieves the RLP encoded storage data associated with a
+	// particular hash, within a particular account. A nil result means the slot
+	// is empty.
+	Storage(accountHash, storageHash common.Hash) ([]byte, error)
+}
+
+// snapshot is the internal version of the snapshot data layer that supports
+// walking the layer hierarchy.
+type snapshot interface {
+	Snapshot
+
+	// Parent returns the subsequent layer of a snapshot, or nil if the base was
+	// reached.
+	Parent() snapshot
+
+	// Stale reports whether this layer has become stale (another layer was
+	// flattened into the disk on top of it).
+	Stale() bool
+}
+
+// Tree is an Ethereum state snapshot tree. It consists of one persistent base
+// layer backed by a key-value store, on top of which arbitrarily many in-memory
+// diff layers are topped. The memory diffs can form a tree with branching, but
+// the disk layer is singleton and common to all. If a reorg goes deeper than
+// the disk layer, the snapshot is unusable until the node is restarted.
+//
+// The goal of a state snapshot is twofold: to allow direct access to account
+// and storage data to avoid expensive multi-level trie lookups; and to allow
+// sorted, cheap iteration of the account/storage tries for sync aid.
+type Tree struct {
+	diskdb ethdb.Database           // Persistent database to store the snapshot
+	triedb *trie.Database           // In-memory cache to access the trie through
+	layers map[common.Hash]snapshot // Collection of all known layers
+	lock   sync.RWMutex
+}
+
+// New attempts to load an already existing snapshot from a persistent key-value
+// store, ensuring that the head of the snapshot matches the expected one. Any
+// interrupted generation is resumed.
+//
+// If the snapshot is missing or inconsistent, the entirety is deleted and will
+// be reconstructed from scratch based on the tries in the key-value store, on a
+// background thread.
+func New(diskdb ethdb.Database, triedb *trie.Database, root common.Hash) *Tree {
+	var marker []byte
+	if stored := readSnapshotRoot(diskdb); stored == root {
+		marker = readGeneratorMarker(diskdb)
+		log.Info("Loaded state snapshot", "root", root, "complete", marker == nil)
+	} else {
+		log.Warn("State snapshot missing or stale, regenerating", "have", stored, "want", root)
+		marker = []byte{}
+		if err := writeSnapshotState(diskdb, root, marker); err != nil {
+			log.Error("Failed to reset state snapshot", "err", err)
+		}
+	}
+	base := newDiskLayer(diskdb, triedb, root, marker)
+
+	return &Tree{
+		diskdb: diskdb,
+		triedb: triedb,
+		layers: map[common.Hash]snapshot{root: base},
+	}
+}
+
+// Snapshot retrieves a snapshot belonging to the given block root, or nil if no
+// snapshot is maintained for that block.
+func (t *Tree) Snapshot(blockRoot common.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if layer, ok := t.layers[blockRoot]; ok {
+		return layer
+	}
+	return nil
+}
+
+// Update adds a new snapshot into the tree, if that can be linked to an existing
+// old parent. It is disallowed to insert a disk layer (the origin of all).
+func (t *Tree) Update(blockRoot common.Hash, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+	// Reject noop updates to avoid self-loops in the snapshot tree. This is a
+	// special case that can only happen for Clique networks where empty blocks
+	// don't modify the state (0 block subsidy).
+	if blockRoot == parentRoot {
+		return errSnapshotCycle
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.layers[blockRoot]; ok {
+		return nil // Already known, e.g. a block reimported after a reorg
+	}
+	parent, ok := t.layers[parentRoot]
+	if !ok {
+		return fmt.Errorf("parent [%#x] snapshot missing", parentRoot)
+	}
+	t.layers[blockRoot] = newDiffLayer(parent, blockRoot, destructs, accounts, storage)
+	return nil
+}
+
+// Cap traverses downwards the snapshot tree from a head block hash until the
+// number of allowed layers are crossed. All layers beyond the permitted number
+// are flattened downwards into the persistent disk layer. Layers on other
+// branches no longer reachable from the new disk layer are discarded.
+func (t *Tree) Cap(root common.Hash, layers int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snap, ok := t.layers[root]
+	if !ok {
+		return fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	// Collect the diff layers from the requested root down to the disk layer
+	var diffs []*diffLayer
+	for layer := snap; ; layer = layer.Parent() {
+		diff, ok := layer.(*diffLayer)
+		if !ok {
+			break
+		}
+		diffs = append(diffs, diff)
+	}
+	if len(diffs) <= layers {
+		return nil
+	}
+	// Flatten all the excess layers into the disk, starting from the bottom
+	base := diffs[len(diffs)-1].Parent().(*diskLayer)
+	for i := len(diffs) - 1; i >= layers; i-- {
+		flattened, err := diffToDisk(base, diffs[i])
+		if err != nil {
+			return err
+		}
+		base = flattened
+	}
+	if layers > 0 {
+		diffs[layers-1].setParent(base)
+	}
+	// Drop all the layers that are not descendants of the new disk layer
+	for root, layer := range t.layers {
+		if !descendsFrom(layer, base) {
+			if diff, ok := layer.(*diffLayer); ok {
+				diff.markStale()
+			}
+			delete(t.layers, root)
+		}
+	}
+	t.layers[base.root] = base
+	return nil
+}
+
+// Rebuild wipes all available snapshot layers and regenerates the persistent
+// disk layer from scratch for the given state root, e.g. after a chain rewind
+// went below the current disk layer.
+func (t *Tree) Rebuild(root common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, layer := range t.layers {
+		switch layer := layer.(type) {
+		case *diskLayer:
+			layer.stopGeneration()
+
+			layer.lock.Lock()
+			layer.stale = true
+			layer.lock.Unlock()
+
+		case *diffLayer:
+			layer.markStale()
+		}
+	}
+	log.Info("Rebuilding state snapshot", "root", root)
+	if err := writeSnapshotState(t.diskdb, root, []byte{}); err != nil {
+		log.Error("Failed to reset state snapshot", "err", err)
+	}
+	t.layers = map[common.Hash]snapshot{root: newDiskLayer(t.diskdb, t.triedb, root, []byte{})}
+}
+
+// Close aborts any running background snapshot generation, persisting its
+// progress so it can be resumed on the next startup.
+func (t *Tree) Close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, layer := range t.layers {
+		if disk, ok := layer.(*diskLayer); ok {
+			disk.stopGeneration()
+		}
+	}
+}
+
+// descendsFrom reports whether the given layer is, or is built on top of, the
+// given disk layer.
+func descendsFrom(layer snapshot, base *diskLayer) bool {
+	for ; layer != nil; layer = layer.Parent() {
+		if layer == snapshot(base) {
+			return true
+		}
+		if layer.Stale() {
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// makeTestState creates a small persisted state with a number of accounts, the
+// first of which also has a few storage slots.
+func makeTestState(t *testing.T, accounts int) (*ethdb.MemDatabase, *trie.Database, common.Hash) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	triedb := trie.NewDatabase(diskdb)
+
+	storeTrie, _ := trie.NewSecure(common.Hash{}, triedb, 0)
+	for i := byte(1); i <= 3; i++ {
+		value, _ := rlp.EncodeToBytes([]byte{i})
+		storeTrie.Update(common.Hash{i}.Bytes(), value)
+	}
+	storeRoot, _ := storeTrie.Commit(nil)
+
+	accTrie, _ := trie.NewSecure(common.Hash{}, triedb, 0)
+	for i := 0; i < accounts; i++ {
+		acc := account{Nonce: uint64(i), Balance: big.NewInt(int64(i)), Root: emptyRoot, CodeHash: crypto.Keccak256(nil)}
+		if i == 0 {
+			acc.Root = storeRoot
+		}
+		blob, _ := rlp.EncodeToBytes(acc)
+		accTrie.Update(common.Address{byte(i)}.Bytes(), blob)
+	}
+	root, _ := accTrie.Commit(nil)
+	if err := triedb.Commit(root, false); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	return diskdb, triedb, root
+}
+
+// waitGeneration blocks until the background generator of the disk layer of
+// the tree terminates.
+func waitGeneration(t *Tree, root common.Hash) {
+	<-t.layers[root].(*diskLayer).genDone
+}
+
+// Tests that a snapshot generated from scratch contains all the accounts and
+// storage slots of the state trie.
+func TestGeneration(t *testing.T) {
+	diskdb, triedb, root := makeTestState(t, 16)
+
+	snaps := New(diskdb, triedb, root)
+	waitGeneration(snaps, root)
+
+	if marker := readGeneratorMarker(diskdb); marker != nil {
+		t.Fatalf("generation marker mismatch: have %x, want nil", marker)
+	}
+	snap := snaps.Snapshot(root)
+	for i := 0; i < 16; i++ {
+		blob, err := snap.Account(crypto.Keccak256Hash(common.Address{byte(i)}.Bytes()))
+		if err != nil {
+			t.Fatalf("account %d: failed to retrieve: %v", i, err)
+		}
+		var acc account
+		if err := rlp.DecodeBytes(blob, &acc); err != nil {
+			t.Fatalf("account %d: failed to decode: %v", i, err)
+		}
+		if acc.Nonce != uint64(i) {
+			t.Errorf("account %d: nonce mismatch: have %d, want %d", i, acc.Nonce, i)
+		}
+	}
+	accHash := crypto.Keccak256Hash(common.Address{0}.Bytes())
+	for i := byte(1); i <= 3; i++ {
+		blob, err := snap.Storage(accHash, crypto.Keccak256Hash(common.Hash{i}.Bytes()))
+		if err != nil {
+			t.Fatalf("slot %d: failed to retrieve: %v", i, err)
+		}
+		want, _ := rlp.EncodeToBytes([]byte{i})
+		if !bytes.Equal(blob, want) {
+			t.Errorf("slot %d: value mismatch: have %x, want %x", i, blob, want)
+		}
+	}
+	// Reopening the snapshot on the same root should not regenerate it
+	if reopened := New(diskdb, triedb, root); reopened.layers[root].(*diskLayer).genMarker != nil {
+		t.Fatalf("complete snapshot regenerated on reload")
+	}
+}
+
+// Tests that diff layers shadow their parents correctly and that capping the
+// tree flattens the bottom layers into the disk and invalidates them.
+func TestDiffLayersAndCap(t *testing.T) {
+	diskdb, triedb, base := makeTestState(t, 4)
+
+	snaps := New(diskdb, triedb, base)
+	waitGeneration(snaps, base)
+
+	var (
+		acc0  = crypto.Keccak256Hash(common.Address{0}.Bytes())
+		acc1  = crypto.Keccak256Hash(common.Address{1}.Bytes())
+		slot1 = crypto.Keccak256Hash(common.Hash{1}.Bytes())
+		root1 = common.HexToHash("0x01")
+		root2 = common.HexToHash("0x02")
+	)
+	// Layer 1 modifies an account and a storage slot, layer 2 destructs them
+	if err := snaps.Update(root1, base, nil, map[common.Hash][]byte{acc1: {0x11}}, map[common.Hash]map[common.Hash][]byte{acc0: {slot1: {0x22}}}); err != nil {
+		t.Fatalf("failed to add layer 1: %v", err)
+	}
+	if err := snaps.Update(root2, root1, map[common.Hash]struct{}{acc0: {}}, nil, nil); err != nil {
+		t.Fatalf("failed to add layer 2: %v", err)
+	}
+	if err := snaps.Update(root2, root2, nil, nil, nil); err == nil {
+		t.Fatalf("self referencing layer accepted")
+	}
+	if blob, _ := snaps.Snapshot(root1).Account(acc1); !bytes.Equal(blob, []byte{0x11}) {
+		t.Errorf("layer 1 account mismatch: have %x, want %x", blob, []byte{0x11})
+	}
+	if blob, _ := snaps.Snapshot(root2).Account(acc1); !bytes.Equal(blob, []byte{0x11}) {
+		t.Errorf("layer 2 account mismatch: have %x, want %x", blob, []byte{0x11})
+	}
+	if blob, _ := snaps.Snapshot(root1).Storage(acc0, slot1); !bytes.Equal(blob, []byte{0x22}) {
+		t.Errorf("layer 1 slot mismatch: have %x, want %x", blob, []byte{0x22})
+	}
+	if blob, _ := snaps.Snapshot(root2).Storage(acc0, slot1); blob != nil {
+		t.Errorf("destructed slot mismatch: have %x, want nil", blob)
+	}
+	if blob, _ := snaps.Snapshot(root2).Account(acc0); blob != nil {
+		t.Errorf("destructed account mismatch: have %x, want nil", blob)
+	}
+	// Flatten layer 1 into the disk and check that the data is persisted
+	bottom := snaps.Snapshot(root1)
+	if err := snaps.Cap(root2, 1); err != nil {
+		t.Fatalf("failed to cap tree: %v", err)
+	}
+	if _, err := bottom.Account(acc1); err != ErrSnapshotStale {
+		t.Errorf("flattened layer error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if snaps.Snapshot(base) != nil {
+		t.Errorf("stale disk layer still referenced")
+	}
+	if have := readSnapshotRoot(diskdb); have != root1 {
+		t.Errorf("persisted root mismatch: have %x, want %x", have, root1)
+	}
+	if blob, _ := snaps.Snapshot(root1).Account(acc1); !bytes.Equal(blob, []byte{0x11}) {
+		t.Errorf("disk account mismatch: have %x, want %x", blob, []byte{0x11})
+	}
+	if blob, _ := snaps.Snapshot(root2).Account(acc0); blob != nil {
+		t.Errorf("capped layer 2 account mismatch: have %x, want nil", blob)
+	}
+	if blob, _ := snaps.Snapshot(root2).Storage(acc0, slot1); blob != nil {
+		t.Errorf("capped layer 2 slot mismatch: have %x, want nil", blob)
+	}
+}
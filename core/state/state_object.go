@@ -66,6 +66,10 @@ type stateObject struct {
 	data     Account
 	db       *StateDB
 
+	// Storage root the account had when loaded from the database, nil for newly
+	// created objects. Flat snapshot reads are only valid while it's unchanged.
+	originRoot *common.Hash
+
 	// DB error.
 	// State objects are used by the consensus core and VM which are
 	// unable to deal with database-level errors. Any error that occurs
@@ -79,6 +83,8 @@ type stateObject struct {
 
 	cachedStorage Storage // Storage entry cache to avoid duplicate reads
 	dirtyStorage  Storage // Storage entries that need to be flushed to disk
+	originStorage Storage // Storage values at the start of the current transaction
+	fakeStorage   Storage // Storage replacing the entire trie content, never committed (nil if unused)
 
 	// Cache flags.
 	// When an object is marked suicided it will be delete from the trie
@@ -170,12 +176,27 @@ func (c *stateObject) getTrie(db Database) Trie {
 
 // GetState returns a value in account storage.
 func (self *stateObject) GetState(db Database, key common.Hash) common.Hash {
+	// If the storage was replaced, the trie content is irrelevant
+	if self.fakeStorage != nil {
+		return self.fakeStorage[key]
+	}
 	value, exists := self.cachedStorage[key]
 	if exists {
 		return value
 	}
-	// Load from DB in case it is missing.
-	enc, err := self.getTrie(db).TryGet(key[:])
+	// Load from the flat snapshot if the storage is unchanged, or the trie otherwise.
+	var (
+		enc []byte
+		err error
+	)
+	snapped := false
+	if snap := self.db.snap; snap != nil && self.originRoot != nil && *self.originRoot == self.data.Root {
+		enc, err = snap.Storage(self.addrHash, crypto.Keccak256Hash(key[:]))
+		snapped = err == nil
+	}
+	if !snapped {
+		enc, err = self.getTrie(db).TryGet(key[:])
+	}
 	if err != nil {
 		self.setError(err)
 		return common.Hash{}
@@ -187,25 +208,49 @@ func (self *stateObject) GetState(db Database, key common.Hash) common.Hash {
 		}
 		value.SetBytes(content)
 	}
+	self.db.recordSlotOrigin(self.address, key, value)
+
 	if (value != common.Hash{}) {
 		self.cachedStorage[key] = value
 	}
 	return value
 }
 
+// GetCommittedState returns the value a storage slot had at the start of the
+// current transaction, ignoring any modifications made since.
+func (self *stateObject) GetCommittedState(db Database, key common.Hash) common.Hash {
+	if value, modified := self.originStorage[key]; modified {
+		return value
+	}
+	return self.GetState(db, key)
+}
+
 // SetState updates a value in account storage.
 func (self *stateObject) SetState(db Database, key, value common.Hash) {
+	prev := self.GetState(db, key)
+
+	// Remember the transaction-start value on the first write to the slot
+	if self.originStorage == nil {
+		self.originStorage = make(Storage)
+	}
+	if _, modified := self.originStorage[key]; !modified {
+		self.originStorage[key] = prev
+	}
 	self.db.journal = append(self.db.journal, storageChange{
 		account:  &self.address,
 		key:      key,
-		prevalue: self.GetState(db, key),
+		prevalue: prev,
 	})
 	self.setState(key, value)
 }
 
 func (self *stateObject) setState(key, value common.Hash) {
-	self.cachedStorage[key] = value
-	self.dirtyStorage[key] = value
+	if self.fakeStorage != nil {
+		self.fakeStorage[key] = value
+	} else {
+		self.cachedStorage[key] = value
+		self.dirtyStorage[key] = value
+	}
 
 	if self.onDirty != nil {
 		self.onDirty(self.Address())
@@ -213,18 +258,39 @@ func (self *stateObject) setState(key, value common.Hash) {
 	}
 }
 
+// SetStorage replaces the entire storage of the account with the given slots.
+// The replacement is never written into the storage trie, so it must only be
+// used on throwaway states, e.g. to override accounts for a call.
+func (self *stateObject) SetStorage(storage map[common.Hash]common.Hash) {
+	self.fakeStorage = make(Storage)
+	for key, value := range storage {
+		self.fakeStorage[key] = value
+	}
+}
+
 // updateTrie writes cached storage modifications into the object's storage trie.
 func (self *stateObject) updateTrie(db Database) Trie {
 	tr := self.getTrie(db)
 	for key, value := range self.dirtyStorage {
 		delete(self.dirtyStorage, key)
+
+		var v []byte
 		if (value == common.Hash{}) {
 			self.setError(tr.TryDelete(key[:]))
-			continue
+		} else {
+			// Encoding []byte cannot fail, ok to ignore the error.
+			v, _ = rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
+			self.setError(tr.TryUpdate(key[:], v))
+		}
+		// Track the slot change for the flat snapshot too
+		if self.db.snap != nil {
+			storage := self.db.snapStorage[self.addrHash]
+			if storage == nil {
+				storage = make(map[common.Hash][]byte)
+				self.db.snapStorage[self.addrHash] = storage
+			}
+			storage[crypto.Keccak256Hash(key[:])] = v
 		}
-		// Encoding []byte cannot fail, ok to ignore the error.
-		v, _ := rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
-		self.setError(tr.TryUpdate(key[:], v))
 	}
 	return tr
 }
@@ -297,9 +363,14 @@ func (self *stateObject) deepCopy(db *StateDB, onDirty func(addr common.Address)
 	if self.trie != nil {
 		stateObject.trie = db.db.CopyTrie(self.trie)
 	}
+	stateObject.originRoot = self.originRoot
 	stateObject.code = self.code
 	stateObject.dirtyStorage = self.dirtyStorage.Copy()
 	stateObject.cachedStorage = self.dirtyStorage.Copy()
+	stateObject.originStorage = self.originStorage.Copy()
+	if self.fakeStorage != nil {
+		stateObject.fakeStorage = self.fakeStorage.Copy()
+	}
 	stateObject.suicided = self.suicided
 	stateObject.dirtyCode = self.dirtyCode
 	stateObject.deleted = self.deleted
@@ -18,12 +18,14 @@
 package state
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"sort"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
@@ -36,10 +38,27 @@ type revision struct {
 	journalIndex int
 }
 
+// proofList collects the nodes of a Merkle proof in the order they are
+// emitted by the trie, discarding the hash keys.
+type proofList [][]byte
+
+func (n *proofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+// snapshotLayers is the number of diff layers kept in memory on top of the flat
+// disk snapshot. It stays below the number of recent tries a full node keeps in
+// memory, so the disk layer state is always available for generation.
+const snapshotLayers = 127
+
 var (
 	// emptyState is the known hash of an empty state trie entry.
 	emptyState = crypto.Keccak256Hash(nil)
 
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
 	// emptyCode is the known hash of the empty EVM bytecode.
 	emptyCode = crypto.Keccak256Hash(nil)
 )
@@ -53,6 +72,20 @@ type StateDB struct {
 	db   Database
 	trie Trie
 
+	// Flat snapshot of the state the StateDB was opened at, if available, along
+	// with the changes to push into the snapshot tree on commit.
+	snaps         *snapshot.Tree
+	snap          snapshot.Snapshot
+	snapRoot      common.Hash
+	snapDestructs map[common.Hash]struct{}
+	snapAccounts  map[common.Hash][]byte
+	snapStorage   map[common.Hash]map[common.Hash][]byte
+
+	// Original values of the accessed accounts and storage slots if reverse state
+	// diffs are tracked, along with the diff produced by the last commit.
+	diffOrigins map[common.Address]*diffOrigin
+	diff        *StateDiff
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects      map[common.Address]*stateObject
 	stateObjectsDirty map[common.Address]struct{}
@@ -89,14 +122,32 @@ func New(root common.Hash, db Database) (*StateDB, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &StateDB{
+	sdb := &StateDB{
 		db:                db,
 		trie:              tr,
+		snaps:             db.Snapshots(),
 		stateObjects:      make(map[common.Address]*stateObject),
 		stateObjectsDirty: make(map[common.Address]struct{}),
 		logs:              make(map[common.Hash][]*types.Log),
 		preimages:         make(map[common.Hash][]byte),
-	}, nil
+	}
+	sdb.resetSnapshot(root)
+	return sdb, nil
+}
+
+// resetSnapshot attaches the flat snapshot of the given state root, if there is
+// one, and clears out the snapshot changes collected so far.
+func (self *StateDB) resetSnapshot(root common.Hash) {
+	self.snap, self.snapRoot = nil, root
+	self.snapDestructs, self.snapAccounts, self.snapStorage = nil, nil, nil
+
+	if self.snaps != nil {
+		if self.snap = self.snaps.Snapshot(root); self.snap != nil {
+			self.snapDestructs = make(map[common.Hash]struct{})
+			self.snapAccounts = make(map[common.Hash][]byte)
+			self.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+		}
+	}
 }
 
 // setError remembers the first non-nil error it is called with.
@@ -126,6 +177,11 @@ func (self *StateDB) Reset(root common.Hash) error {
 	self.logs = make(map[common.Hash][]*types.Log)
 	self.logSize = 0
 	self.preimages = make(map[common.Hash][]byte)
+	if self.diffOrigins != nil {
+		self.diffOrigins = make(map[common.Address]*diffOrigin)
+	}
+	self.diff = nil
+	self.resetSnapshot(root)
 	self.clearJournalAndRefund()
 	return nil
 }
@@ -173,6 +229,16 @@ func (self *StateDB) AddRefund(gas uint64) {
 	self.refund += gas
 }
 
+// SubRefund removes gas from the refund counter.
+// This method will panic if the refund counter goes below zero
+func (self *StateDB) SubRefund(gas uint64) {
+	self.journal = append(self.journal, refundChange{prev: self.refund})
+	if gas > self.refund {
+		panic("Refund counter below zero")
+	}
+	self.refund -= gas
+}
+
 // Exist reports whether the given account address exists in the state.
 // Notably this also returns true for suicided accounts.
 func (self *StateDB) Exist(addr common.Address) bool {
@@ -243,6 +309,16 @@ func (self *StateDB) GetState(a common.Address, b common.Hash) common.Hash {
 	return common.Hash{}
 }
 
+// GetCommittedState retrieves the value of a storage slot as it was at the
+// start of the current transaction.
+func (self *StateDB) GetCommittedState(a common.Address, b common.Hash) common.Hash {
+	stateObject := self.getStateObject(a)
+	if stateObject != nil {
+		return stateObject.GetCommittedState(self.db, b)
+	}
+	return common.Hash{}
+}
+
 // Database retrieves the low level database supporting the lower level trie ops.
 func (self *StateDB) Database() Database {
 	return self.db
@@ -259,6 +335,26 @@ func (self *StateDB) StorageTrie(a common.Address) Trie {
 	return cpy.updateTrie(self.db)
 }
 
+// GetProof returns the Merkle proof for a given account, ordered from the
+// root of the account trie down to the node holding the account.
+func (self *StateDB) GetProof(a common.Address) ([][]byte, error) {
+	var proof proofList
+	err := self.trie.Prove(crypto.Keccak256(a.Bytes()), 0, &proof)
+	return [][]byte(proof), err
+}
+
+// GetStorageProof returns the Merkle proof for a given storage slot of an
+// account, ordered from the root of the storage trie down to the slot.
+func (self *StateDB) GetStorageProof(a common.Address, key common.Hash) ([][]byte, error) {
+	var proof proofList
+	trie := self.StorageTrie(a)
+	if trie == nil {
+		return proof, errors.New("storage trie for requested address does not exist")
+	}
+	err := trie.Prove(crypto.Keccak256(key.Bytes()), 0, &proof)
+	return [][]byte(proof), err
+}
+
 func (self *StateDB) HasSuicided(addr common.Address) bool {
 	stateObject := self.getStateObject(addr)
 	if stateObject != nil {
@@ -315,6 +411,15 @@ func (self *StateDB) SetState(addr common.Address, key common.Hash, value common
 	}
 }
 
+// SetStorage replaces the entire storage of the given account. The replacement
+// is never committed, it should only be used for debugging and call overrides.
+func (self *StateDB) SetStorage(addr common.Address, storage map[common.Hash]common.Hash) {
+	stateObject := self.GetOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.SetStorage(storage)
+	}
+}
+
 // Suicide marks the given account as suicided.
 // This clears the account balance.
 //
@@ -348,6 +453,11 @@ func (self *StateDB) updateStateObject(stateObject *stateObject) {
 		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
 	}
 	self.setError(self.trie.TryUpdate(addr[:], data))
+
+	// Track the account change for the flat snapshot too
+	if self.snap != nil {
+		self.snapAccounts[stateObject.addrHash] = data
+	}
 }
 
 // deleteStateObject removes the given object from the state trie.
@@ -355,6 +465,13 @@ func (self *StateDB) deleteStateObject(stateObject *stateObject) {
 	stateObject.deleted = true
 	addr := stateObject.Address()
 	self.setError(self.trie.TryDelete(addr[:]))
+
+	// Track the account deletion for the flat snapshot too
+	if self.snap != nil {
+		self.snapDestructs[stateObject.addrHash] = struct{}{}
+		delete(self.snapAccounts, stateObject.addrHash)
+		delete(self.snapStorage, stateObject.addrHash)
+	}
 }
 
 // Retrieve a state object given my the address. Returns nil if not found.
@@ -367,10 +484,22 @@ func (self *StateDB) getStateObject(addr common.Address) (stateObject *stateObje
 		return obj
 	}
 
-	// Load the object from the database.
-	enc, err := self.trie.TryGet(addr[:])
+	// Load the object from the flat snapshot if available, or the trie otherwise.
+	var (
+		enc []byte
+		err error
+	)
+	if self.snap != nil {
+		enc, err = self.snap.Account(crypto.Keccak256Hash(addr[:]))
+	}
+	if self.snap == nil || err != nil {
+		enc, err = self.trie.TryGet(addr[:])
+	}
 	if len(enc) == 0 {
 		self.setError(err)
+		if err == nil {
+			self.recordAccountOrigin(addr, nil)
+		}
 		return nil
 	}
 	var data Account
@@ -378,8 +507,12 @@ func (self *StateDB) getStateObject(addr common.Address) (stateObject *stateObje
 		log.Error("Failed to decode state object", "addr", addr, "err", err)
 		return nil
 	}
+	self.recordAccountOrigin(addr, enc)
+
 	// Insert into the live set.
 	obj := newObject(self, addr, data, self.MarkStateObjectDirty)
+	origin := data.Root
+	obj.originRoot = &origin
 	self.setStateObject(obj)
 	return obj
 }
@@ -472,6 +605,9 @@ func (self *StateDB) Copy() *StateDB {
 		logs:              make(map[common.Hash][]*types.Log, len(self.logs)),
 		logSize:           self.logSize,
 		preimages:         make(map[common.Hash][]byte),
+		snaps:             self.snaps,
+		snap:              self.snap,
+		snapRoot:          self.snapRoot,
 	}
 	// Copy the dirty states, logs, and preimages
 	for addr := range self.stateObjectsDirty {
@@ -485,6 +621,33 @@ func (self *StateDB) Copy() *StateDB {
 	for hash, preimage := range self.preimages {
 		state.preimages[hash] = preimage
 	}
+	if self.snap != nil {
+		state.snapDestructs = make(map[common.Hash]struct{}, len(self.snapDestructs))
+		for hash := range self.snapDestructs {
+			state.snapDestructs[hash] = struct{}{}
+		}
+		state.snapAccounts = make(map[common.Hash][]byte, len(self.snapAccounts))
+		for hash, data := range self.snapAccounts {
+			state.snapAccounts[hash] = data
+		}
+		state.snapStorage = make(map[common.Hash]map[common.Hash][]byte, len(self.snapStorage))
+		for hash, storage := range self.snapStorage {
+			state.snapStorage[hash] = make(map[common.Hash][]byte, len(storage))
+			for key, data := range storage {
+				state.snapStorage[hash][key] = data
+			}
+		}
+	}
+	if self.diffOrigins != nil {
+		state.diffOrigins = make(map[common.Address]*diffOrigin, len(self.diffOrigins))
+		for addr, origin := range self.diffOrigins {
+			cpy := &diffOrigin{account: origin.account, storage: make(map[common.Hash]common.Hash, len(origin.storage))}
+			for key, value := range origin.storage {
+				cpy.storage[key] = value
+			}
+			state.diffOrigins[addr] = cpy
+		}
+	}
 	return state
 }
 
@@ -527,6 +690,8 @@ func (self *StateDB) GetRefund() uint64 {
 func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 	for addr := range s.stateObjectsDirty {
 		stateObject := s.stateObjects[addr]
+		stateObject.originStorage = nil
+
 		if stateObject.suicided || (deleteEmptyObjects && stateObject.empty()) {
 			s.deleteStateObject(stateObject)
 		} else {
@@ -585,9 +750,18 @@ func (s *StateDB) clearJournalAndRefund() {
 func (s *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error) {
 	defer s.clearJournalAndRefund()
 
+	// Gather the modified accounts if a reverse state diff is needed
+	var diffAddrs []common.Address
+	if s.diffOrigins != nil {
+		for addr := range s.stateObjectsDirty {
+			diffAddrs = append(diffAddrs, addr)
+		}
+	}
 	// Commit objects to the trie.
 	for addr, stateObject := range s.stateObjects {
 		_, isDirty := s.stateObjectsDirty[addr]
+		stateObject.originStorage = nil
+
 		switch {
 		case stateObject.suicided || (isDirty && deleteEmptyObjects && stateObject.empty()):
 			// If the object has been removed, don't bother syncing it
@@ -624,5 +798,23 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error)
 		return nil
 	})
 	log.Debug("Trie cache stats after commit", "misses", trie.CacheMisses(), "unloads", trie.CacheUnloads())
-	return root, err
+	if err != nil {
+		return root, err
+	}
+	if s.diffOrigins != nil {
+		if s.diff, err = s.buildDiff(diffAddrs); err != nil {
+			return root, err
+		}
+	}
+	// Push the changes into the snapshot tree and flatten any excess layers
+	if s.snap != nil && root != s.snapRoot {
+		if err := s.snaps.Update(root, s.snapRoot, s.snapDestructs, s.snapAccounts, s.snapStorage); err != nil {
+			log.Warn("Failed to update snapshot tree", "from", s.snapRoot, "to", root, "err", err)
+		}
+		if err := s.snaps.Cap(root, snapshotLayers); err != nil {
+			log.Warn("Failed to cap snapshot tree", "root", root, "layers", snapshotLayers, "err", err)
+		}
+	}
+	s.resetSnapshot(root)
+	return root, nil
 }
@@ -32,7 +32,10 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 // Tests that updating a state trie does not leak any database writes prior to
@@ -421,3 +424,145 @@ func (s *StateSuite) TestTouchDelete(c *check.C) {
 		c.Fatal("expected no dirty state object")
 	}
 }
+
+// Tests that account and storage proofs generated from a state database can be
+// verified against the state and storage roots respectively.
+func TestStateProofs(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	for i := byte(0); i < 64; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(int64(11*i)))
+		state.SetState(addr, common.BytesToHash([]byte{i}), common.BytesToHash([]byte{i, i + 1}))
+	}
+	root := state.IntermediateRoot(false)
+
+	for i := byte(0); i < 64; i++ {
+		addr := common.BytesToAddress([]byte{i})
+
+		// Verify the account proof against the state root
+		proof, err := state.GetProof(addr)
+		if err != nil {
+			t.Fatalf("account %d: failed to generate proof: %v", i, err)
+		}
+		if _, err, _ := trie.VerifyProof(root, crypto.Keccak256(addr.Bytes()), proofDatabase(proof)); err != nil {
+			t.Fatalf("account %d: failed to verify proof: %v", i, err)
+		}
+		// Verify the storage proof against the storage root
+		proof, err = state.GetStorageProof(addr, common.BytesToHash([]byte{i}))
+		if err != nil {
+			t.Fatalf("account %d: failed to generate storage proof: %v", i, err)
+		}
+		storageRoot := state.StorageTrie(addr).Hash()
+		val, err, _ := trie.VerifyProof(storageRoot, crypto.Keccak256(common.BytesToHash([]byte{i}).Bytes()), proofDatabase(proof))
+		if err != nil {
+			t.Fatalf("account %d: failed to verify storage proof: %v", i, err)
+		}
+		var value []byte
+		rlp.DecodeBytes(val, &value)
+		if have := common.BytesToHash(value); have != common.BytesToHash([]byte{i, i + 1}) {
+			t.Errorf("account %d: storage value mismatch: have %x, want %x", i, have, []byte{i, i + 1})
+		}
+	}
+	// Missing accounts have no storage trie to prove against
+	if _, err := state.GetStorageProof(common.Address{0xff}, common.Hash{}); err == nil {
+		t.Errorf("storage proof for missing account succeeded")
+	}
+}
+
+// proofDatabase inserts a list of proof nodes into an in-memory database keyed
+// by their hashes.
+func proofDatabase(proof [][]byte) *ethdb.MemDatabase {
+	db, _ := ethdb.NewMemDatabase()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
+
+// Tests that state changes are pushed into the flat snapshot on commit and that
+// reads served through the snapshot layers match the tries.
+func TestFlatSnapshotReads(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabaseWithSnapshots(db, common.Hash{})
+
+	var (
+		addr1 = common.BytesToAddress([]byte{0x01})
+		addr2 = common.BytesToAddress([]byte{0x02})
+		key   = common.BytesToHash([]byte{0x03})
+	)
+	state, _ := New(common.Hash{}, sdb)
+	state.SetBalance(addr1, big.NewInt(42))
+	state.SetState(addr1, key, common.BytesToHash([]byte{0x04}))
+	state.SetNonce(addr2, 1)
+	root1, _ := state.Commit(false)
+
+	state, _ = New(root1, sdb)
+	state.SetState(addr1, key, common.BytesToHash([]byte{0x05}))
+	state.Suicide(addr2)
+	root2, _ := state.Commit(false)
+
+	for i, root := range []common.Hash{root1, root2} {
+		if sdb.Snapshots().Snapshot(root) == nil {
+			t.Fatalf("state %d: snapshot missing", i)
+		}
+	}
+	state, _ = New(root2, sdb)
+	if balance := state.GetBalance(addr1); balance.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("balance mismatch: have %v, want %v", balance, 42)
+	}
+	if value := state.GetState(addr1, key); value != common.BytesToHash([]byte{0x05}) {
+		t.Errorf("storage mismatch: have %x, want %x", value, []byte{0x05})
+	}
+	if state.Exist(addr2) {
+		t.Errorf("destructed account still exists")
+	}
+	state, _ = New(root1, sdb)
+	if value := state.GetState(addr1, key); value != common.BytesToHash([]byte{0x04}) {
+		t.Errorf("historical storage mismatch: have %x, want %x", value, []byte{0x04})
+	}
+	if nonce := state.GetNonce(addr2); nonce != 1 {
+		t.Errorf("historical nonce mismatch: have %d, want %d", nonce, 1)
+	}
+}
+
+// Tests that the transaction-start value of a storage slot is retained across
+// modifications and reverts, and is rolled forward when the transaction ends.
+func TestCommittedState(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	var (
+		addr = common.BytesToAddress([]byte{0x01})
+		key  = common.BytesToHash([]byte{0x02})
+		val1 = common.BytesToHash([]byte{0x03})
+		val2 = common.BytesToHash([]byte{0x04})
+	)
+	state.SetState(addr, key, val1)
+	if value := state.GetCommittedState(addr, key); value != (common.Hash{}) {
+		t.Errorf("committed value mismatch before finalise: have %x, want %x", value, common.Hash{})
+	}
+	state.Finalise(false)
+
+	snap := state.Snapshot()
+	state.SetState(addr, key, val2)
+	if value := state.GetCommittedState(addr, key); value != val1 {
+		t.Errorf("committed value mismatch after write: have %x, want %x", value, val1)
+	}
+	state.RevertToSnapshot(snap)
+	if value := state.GetCommittedState(addr, key); value != val1 {
+		t.Errorf("committed value mismatch after revert: have %x, want %x", value, val1)
+	}
+	state.SetState(addr, key, val2)
+	state.Finalise(false)
+
+	if value := state.GetCommittedState(addr, key); value != val2 {
+		t.Errorf("committed value mismatch after second finalise: have %x, want %x", value, val2)
+	}
+	cpy := state.Copy()
+	cpy.SetState(addr, key, val1)
+	if value := cpy.GetCommittedState(addr, key); value != val2 {
+		t.Errorf("committed value mismatch in copy: have %x, want %x", value, val2)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// errIncompleteDiff is returned when attempting to revert a state diff which
+// lacks some of the storage slots of a destructed account.
+var errIncompleteDiff = errors.New("incomplete state diff")
+
+// StateDiff is the reverse diff of the state changes made by a block, holding
+// the previous values of every account and storage slot the block modified.
+// Applying it to the state after the block yields the state before it.
+type StateDiff struct {
+	Accounts []StateDiffAccount
+}
+
+// StateDiffAccount is the previous state of a single account modified by a
+// block.
+type StateDiffAccount struct {
+	Address  common.Address
+	Prev     []byte          // RLP encoded account before the block, empty if it didn't exist
+	Destruct bool            // Whether the storage was wiped, Storage holding all previous slots
+	Storage  []StateDiffSlot // Previous values of the modified storage slots
+
+	// Incomplete is set if the account was destructed, but the preimages of some
+	// of its storage slot keys were unknown, so they couldn't be recorded.
+	Incomplete bool
+}
+
+// StateDiffSlot is the previous value of a single storage slot.
+type StateDiffSlot struct {
+	Key   common.Hash
+	Value common.Hash
+}
+
+// diffOrigin is the state of an account before the changes being tracked for a
+// reverse state diff.
+type diffOrigin struct {
+	account []byte                      // RLP encoded account, nil if it didn't exist
+	storage map[common.Hash]common.Hash // Previous values of the accessed storage slots
+}
+
+// TrackDiffs enables tracking the previous values of all the accounts and slots
+// modified in the state, making Commit produce a reverse state diff, available
+// through Diff afterwards.
+func (self *StateDB) TrackDiffs() {
+	if self.diffOrigins == nil {
+		self.diffOrigins = make(map[common.Address]*diffOrigin)
+	}
+}
+
+// Diff returns the reverse state diff produced by the last Commit, or nil if no
+// diffs are tracked.
+func (self *StateDB) Diff() *StateDiff {
+	return self.diff
+}
+
+// recordAccountOrigin stores the original value of an account loaded from the
+// database, unless already known.
+func (self *StateDB) recordAccountOrigin(addr common.Address, enc []byte) {
+	if self.diffOrigins == nil {
+		return
+	}
+	if _, ok := self.diffOrigins[addr]; !ok {
+		self.diffOrigins[addr] = &diffOrigin{account: common.CopyBytes(enc), storage: make(map[common.Hash]common.Hash)}
+	}
+}
+
+// recordSlotOrigin stores the original value of a storage slot loaded from the
+// database, unless already known.
+func (self *StateDB) recordSlotOrigin(addr common.Address, key, value common.Hash) {
+	if self.diffOrigins == nil {
+		return
+	}
+	if origin := self.diffOrigins[addr]; origin != nil {
+		if _, ok := origin.storage[key]; !ok {
+			origin.storage[key] = value
+		}
+	}
+}
+
+// buildDiff assembles the reverse state diff of the given committed accounts and
+// resets the tracked origins to the committed values.
+func (self *StateDB) buildDiff(addrs []common.Address) (*StateDiff, error) {
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+
+	diff := new(StateDiff)
+	for _, addr := range addrs {
+		origin := self.diffOrigins[addr]
+		if origin == nil {
+			log.Error("Missing state diff origin", "address", addr)
+			continue
+		}
+		var current []byte
+		obj := self.stateObjects[addr]
+		if obj != nil && !obj.deleted {
+			enc, err := rlp.EncodeToBytes(obj)
+			if err != nil {
+				return nil, err
+			}
+			current = enc
+		}
+		entry := StateDiffAccount{Address: addr, Prev: origin.account}
+
+		// If the original account was removed or replaced, record its full storage
+		if origin.account != nil && (current == nil || obj.originRoot == nil) {
+			entry.Destruct = true
+
+			var data Account
+			if err := rlp.DecodeBytes(origin.account, &data); err != nil {
+				return nil, err
+			}
+			if data.Root != emptyRoot {
+				tr, err := self.db.OpenStorageTrie(crypto.Keccak256Hash(addr[:]), data.Root)
+				if err != nil {
+					return nil, err
+				}
+				it := trie.NewIterator(tr.NodeIterator(nil))
+				for it.Next() {
+					key := tr.GetKey(it.Key)
+					if key == nil {
+						entry.Incomplete = true
+						continue
+					}
+					_, content, _, err := rlp.Split(it.Value)
+					if err != nil {
+						return nil, err
+					}
+					entry.Storage = append(entry.Storage, StateDiffSlot{Key: common.BytesToHash(key), Value: common.BytesToHash(content)})
+				}
+				if it.Err != nil {
+					return nil, it.Err
+				}
+			}
+		} else if obj != nil {
+			// Otherwise only record the modified slots
+			for key, value := range origin.storage {
+				if cur, ok := obj.cachedStorage[key]; ok && cur != value {
+					entry.Storage = append(entry.Storage, StateDiffSlot{Key: key, Value: value})
+				}
+			}
+			sort.Slice(entry.Storage, func(i, j int) bool {
+				return bytes.Compare(entry.Storage[i].Key[:], entry.Storage[j].Key[:]) < 0
+			})
+		}
+		if !entry.Destruct && len(entry.Storage) == 0 && bytes.Equal(current, origin.account) {
+			continue // Touched, but not modified
+		}
+		diff.Accounts = append(diff.Accounts, entry)
+	}
+	// The committed values are the origins of any subsequent changes
+	for _, addr := range addrs {
+		origin := &diffOrigin{storage: make(map[common.Hash]common.Hash)}
+		if obj := self.stateObjects[addr]; obj != nil && !obj.deleted {
+			origin.account, _ = rlp.EncodeToBytes(obj)
+			for key, value := range obj.cachedStorage {
+				origin.storage[key] = value
+			}
+		}
+		self.diffOrigins[addr] = origin
+	}
+	return diff, nil
+}
+
+// RevertDiff rolls the state back by applying the given reverse state diff. The
+// resulting state is meant for reading, it should not be committed.
+func (self *StateDB) RevertDiff(diff *StateDiff) error {
+	for _, entry := range diff.Accounts {
+		obj := self.getStateObject(entry.Address)
+		if len(entry.Prev) == 0 {
+			// The account didn't exist before the block, delete it
+			if obj != nil {
+				self.deleteStateObject(obj)
+				delete(self.stateObjectsDirty, entry.Address)
+			}
+			continue
+		}
+		if entry.Incomplete {
+			return fmt.Errorf("%v: account %x", errIncompleteDiff, entry.Address)
+		}
+		var data Account
+		if err := rlp.DecodeBytes(entry.Prev, &data); err != nil {
+			return err
+		}
+		// Start from a clean storage if it was wiped by the block
+		if obj == nil || entry.Destruct {
+			obj, _ = self.createObject(entry.Address)
+		}
+		obj.setNonce(data.Nonce)
+		obj.setBalance(data.Balance)
+		if !bytes.Equal(obj.CodeHash(), data.CodeHash) {
+			var (
+				codeHash = common.BytesToHash(data.CodeHash)
+				code     []byte
+			)
+			if codeHash != emptyCode {
+				var err error
+				if code, err = self.db.ContractCode(obj.addrHash, codeHash); err != nil {
+					return err
+				}
+			}
+			obj.setCode(codeHash, code)
+		}
+		for _, slot := range entry.Storage {
+			obj.setState(slot.Key, slot.Value)
+		}
+	}
+	self.clearJournalAndRefund()
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// Tests that the reverse state diffs produced on commit roll the state back to
+// its exact previous version, across multiple consecutive changes.
+func TestStateDiffRevert(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+
+	commit := func(root common.Hash, mutate func(state *StateDB)) (common.Hash, *StateDiff) {
+		state, _ := New(root, sdb)
+		state.TrackDiffs()
+		mutate(state)
+
+		root, err := state.Commit(true)
+		if err != nil {
+			t.Fatalf("failed to commit state: %v", err)
+		}
+		if err := sdb.TrieDB().Commit(root, false); err != nil {
+			t.Fatalf("failed to commit trie: %v", err)
+		}
+		return root, state.Diff()
+	}
+	// Create a base state with plain accounts and contracts
+	base, _ := commit(common.Hash{}, func(state *StateDB) {
+		for i := byte(1); i <= 16; i++ {
+			addr := common.BytesToAddress([]byte{i})
+			state.AddBalance(addr, big.NewInt(int64(i)))
+			if i%4 == 0 {
+				state.SetCode(addr, []byte{i})
+				for j := byte(1); j <= 8; j++ {
+					state.SetState(addr, common.BytesToHash([]byte{j}), common.BytesToHash([]byte{i, j}))
+				}
+			}
+		}
+	})
+	// Modify balances and storage, create and destruct accounts
+	first, diff1 := commit(base, func(state *StateDB) {
+		state.AddBalance(common.BytesToAddress([]byte{1}), big.NewInt(100))
+		state.SetNonce(common.BytesToAddress([]byte{2}), 5)
+		state.SetState(common.BytesToAddress([]byte{4}), common.BytesToHash([]byte{1}), common.Hash{})
+		state.SetState(common.BytesToAddress([]byte{4}), common.BytesToHash([]byte{2}), common.BytesToHash([]byte{0xff}))
+		state.SetState(common.BytesToAddress([]byte{4}), common.BytesToHash([]byte{9}), common.BytesToHash([]byte{0xff}))
+		state.Suicide(common.BytesToAddress([]byte{8}))
+		state.AddBalance(common.BytesToAddress([]byte{0xaa}), big.NewInt(1))
+		state.GetState(common.BytesToAddress([]byte{12}), common.BytesToHash([]byte{1}))
+	})
+	second, diff2 := commit(first, func(state *StateDB) {
+		state.SubBalance(common.BytesToAddress([]byte{1}), big.NewInt(50))
+		state.Suicide(common.BytesToAddress([]byte{0xaa}))
+		state.CreateAccount(common.BytesToAddress([]byte{12}))
+		state.SetState(common.BytesToAddress([]byte{12}), common.BytesToHash([]byte{3}), common.BytesToHash([]byte{3}))
+		state.SetCode(common.BytesToAddress([]byte{8}), []byte{0x08})
+	})
+	// Read-only accesses must not end up in the diffs
+	for _, entry := range diff1.Accounts {
+		if entry.Address == common.BytesToAddress([]byte{12}) {
+			t.Errorf("unmodified account in diff")
+		}
+	}
+	// Revert the diffs one by one and check the resulting state roots
+	state, _ := New(second, sdb)
+	if err := state.RevertDiff(diff2); err != nil {
+		t.Fatalf("failed to revert second diff: %v", err)
+	}
+	if root := state.IntermediateRoot(false); root != first {
+		t.Fatalf("first state root mismatch: have %x, want %x", root, first)
+	}
+	if err := state.RevertDiff(diff1); err != nil {
+		t.Fatalf("failed to revert first diff: %v", err)
+	}
+	if root := state.IntermediateRoot(false); root != base {
+		t.Fatalf("base state root mismatch: have %x, want %x", root, base)
+	}
+}
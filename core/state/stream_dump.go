@@ -0,0 +1,315 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// The streaming state dump is a sequence of RLP items, each of them prefixed by
+// its own length as per the RLP encoding rules. The first item is a header
+// identifying the format and the state root, followed by one record for every
+// account in the state, each followed by the records of its storage slots.
+// Accounts and slots are stored in the iteration order of their tries, keyed by
+// their hashes, so the dump can be imported even without the key preimages.
+const (
+	stateDumpMagic   = "gethstate"
+	stateDumpVersion = 1
+)
+
+// Record kinds within a streaming state dump.
+const (
+	dumpAccountRecord = iota // Account record, starting a new account
+	dumpStorageRecord        // Storage slot record, belonging to the last account
+)
+
+// stateDumpImportFlush is the amount of in-memory trie data accumulated during
+// an import before it's flushed to disk.
+const stateDumpImportFlush = 256 * 1024 * 1024
+
+// errStateDumpStorage is returned if a storage record is encountered in a state
+// dump before any account records.
+var errStateDumpStorage = errors.New("storage record without account")
+
+// stateDumpHeader is the first item in a streaming state dump.
+type stateDumpHeader struct {
+	Magic   string
+	Version uint64
+	Root    common.Hash
+}
+
+// stateDumpAccount is the record of a single account in a streaming state dump.
+type stateDumpAccount struct {
+	Hash     common.Hash // Hash of the account address, the account trie key
+	Address  []byte      // Address of the account, empty if the preimage is unknown
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+	Code     []byte
+}
+
+// stateDumpStorage is the record of a single storage slot in a streaming state
+// dump.
+type stateDumpStorage struct {
+	Hash  common.Hash // Hash of the slot key, the storage trie key
+	Key   []byte      // Key of the slot, empty if the preimage is unknown
+	Value []byte      // RLP encoded slot value, as stored in the trie
+}
+
+// writeDumpRecord streams a single record of the given kind into a state dump.
+func writeDumpRecord(w io.Writer, kind uint64, record interface{}) error {
+	return rlp.Encode(w, []interface{}{kind, record})
+}
+
+// ExportDump streams the entire state into the writer in the compact binary
+// state dump format, without accumulating it in memory. The number of exported
+// accounts and storage slots is returned.
+func (self *StateDB) ExportDump(w io.Writer) (accounts uint64, slots uint64, err error) {
+	root := self.trie.Hash()
+	if err := rlp.Encode(w, &stateDumpHeader{Magic: stateDumpMagic, Version: stateDumpVersion, Root: root}); err != nil {
+		return 0, 0, err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	it := trie.NewIterator(self.trie.NodeIterator(nil))
+	for it.Next() {
+		var data Account
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			return accounts, slots, err
+		}
+		account := &stateDumpAccount{
+			Hash:     common.BytesToHash(it.Key),
+			Address:  self.trie.GetKey(it.Key),
+			Nonce:    data.Nonce,
+			Balance:  data.Balance,
+			Root:     data.Root,
+			CodeHash: data.CodeHash,
+		}
+		if !bytes.Equal(data.CodeHash, emptyCodeHash) {
+			if account.Code, err = self.db.ContractCode(account.Hash, common.BytesToHash(data.CodeHash)); err != nil {
+				return accounts, slots, err
+			}
+		}
+		if err := writeDumpRecord(w, dumpAccountRecord, account); err != nil {
+			return accounts, slots, err
+		}
+		accounts++
+
+		// Stream all the storage slots of the account after it
+		if data.Root != emptyRoot {
+			storage, err := self.db.OpenStorageTrie(account.Hash, data.Root)
+			if err != nil {
+				return accounts, slots, err
+			}
+			storageIt := trie.NewIterator(storage.NodeIterator(nil))
+			for storageIt.Next() {
+				slot := &stateDumpStorage{
+					Hash:  common.BytesToHash(storageIt.Key),
+					Key:   self.trie.GetKey(storageIt.Key),
+					Value: storageIt.Value,
+				}
+				if err := writeDumpRecord(w, dumpStorageRecord, slot); err != nil {
+					return accounts, slots, err
+				}
+				slots++
+			}
+			if storageIt.Err != nil {
+				return accounts, slots, storageIt.Err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting state", "root", root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if it.Err != nil {
+		return accounts, slots, it.Err
+	}
+	log.Info("Exported state", "root", root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+	return accounts, slots, nil
+}
+
+// ImportDump reads a state dump in the compact binary format from the reader and
+// rebuilds the account and storage tries, along with the contract codes, in the
+// database. The root of the imported state is returned, once verified against
+// the one recorded in the dump.
+func ImportDump(db ethdb.Database, r io.Reader) (common.Hash, error) {
+	stream := rlp.NewStream(r, 0)
+
+	var header stateDumpHeader
+	if err := stream.Decode(&header); err != nil {
+		return common.Hash{}, fmt.Errorf("invalid state dump header: %v", err)
+	}
+	if header.Magic != stateDumpMagic || header.Version != stateDumpVersion {
+		return common.Hash{}, fmt.Errorf("unsupported state dump: magic %q, version %d", header.Magic, header.Version)
+	}
+	triedb := trie.NewDatabase(db)
+	accTrie, _ := trie.New(common.Hash{}, triedb)
+
+	var (
+		account   *stateDumpAccount // Account currently being imported
+		storeTrie *trie.Trie        // Storage trie of the account being imported
+
+		accounts, slots uint64
+		start           = time.Now()
+		logged          = time.Now()
+	)
+	// commitAccount inserts the account being imported into the account trie,
+	// after verifying that its storage and code are consistent with it
+	commitAccount := func() error {
+		if account == nil {
+			return nil
+		}
+		root := emptyRoot
+		if storeTrie != nil {
+			var err error
+			if root, err = storeTrie.Commit(nil); err != nil {
+				return err
+			}
+		}
+		if root != account.Root {
+			return fmt.Errorf("account %x: storage root mismatch: have %x, want %x", account.Hash, root, account.Root)
+		}
+		if hash := crypto.Keccak256(account.Code); !bytes.Equal(hash, account.CodeHash) {
+			return fmt.Errorf("account %x: code hash mismatch: have %x, want %x", account.Hash, hash, account.CodeHash)
+		}
+		if len(account.Code) > 0 {
+			triedb.Insert(common.BytesToHash(account.CodeHash), account.Code)
+		}
+		if len(account.Address) > 0 {
+			triedb.InsertPreimage(account.Hash, account.Address)
+		}
+		enc, err := rlp.EncodeToBytes(&Account{
+			Nonce:    account.Nonce,
+			Balance:  account.Balance,
+			Root:     account.Root,
+			CodeHash: account.CodeHash,
+		})
+		if err != nil {
+			return err
+		}
+		hash := account.Hash
+		account, storeTrie = nil, nil
+
+		return accTrie.TryUpdate(hash[:], enc)
+	}
+	// commitTries flushes the account trie accumulated so far, along with all
+	// the referenced storage tries and codes, into the database
+	commitTries := func() (common.Hash, error) {
+		root, err := accTrie.Commit(func(leaf []byte, parent common.Hash) error {
+			var account Account
+			if err := rlp.DecodeBytes(leaf, &account); err != nil {
+				return nil
+			}
+			if account.Root != emptyRoot {
+				triedb.Reference(account.Root, parent)
+			}
+			if code := common.BytesToHash(account.CodeHash); code != emptyCode {
+				triedb.Reference(code, parent)
+			}
+			return nil
+		})
+		if err != nil {
+			return common.Hash{}, err
+		}
+		return root, triedb.Commit(root, false)
+	}
+	for {
+		if _, err := stream.List(); err == io.EOF {
+			break
+		} else if err != nil {
+			return common.Hash{}, err
+		}
+		kind, err := stream.Uint()
+		if err != nil {
+			return common.Hash{}, err
+		}
+		switch kind {
+		case dumpAccountRecord:
+			if err := commitAccount(); err != nil {
+				return common.Hash{}, err
+			}
+			account = new(stateDumpAccount)
+			if err := stream.Decode(account); err != nil {
+				return common.Hash{}, err
+			}
+			accounts++
+
+		case dumpStorageRecord:
+			if account == nil {
+				return common.Hash{}, errStateDumpStorage
+			}
+			var slot stateDumpStorage
+			if err := stream.Decode(&slot); err != nil {
+				return common.Hash{}, err
+			}
+			if storeTrie == nil {
+				storeTrie, _ = trie.New(common.Hash{}, triedb)
+			}
+			if err := storeTrie.TryUpdate(slot.Hash[:], slot.Value); err != nil {
+				return common.Hash{}, err
+			}
+			if len(slot.Key) > 0 {
+				triedb.InsertPreimage(slot.Hash, slot.Key)
+			}
+			slots++
+
+		default:
+			return common.Hash{}, fmt.Errorf("unknown state dump record kind %d", kind)
+		}
+		if err := stream.ListEnd(); err != nil {
+			return common.Hash{}, err
+		}
+		// Flush the tries to disk if enough data was accumulated in memory
+		if storeTrie == nil && triedb.Size() > stateDumpImportFlush {
+			if _, err := commitTries(); err != nil {
+				return common.Hash{}, err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Importing state", "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := commitAccount(); err != nil {
+		return common.Hash{}, err
+	}
+	root, err := commitTries()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if root != header.Root {
+		return common.Hash{}, fmt.Errorf("state root mismatch: have %x, want %x", root, header.Root)
+	}
+	log.Info("Imported state", "root", root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+	return root, nil
+}
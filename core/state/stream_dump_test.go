@@ -0,0 +1,81 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// Tests that a state exported into the streaming dump format can be imported
+// into a fresh database, yielding the exact same state.
+func TestStreamDumpRoundtrip(t *testing.T) {
+	// Create a state with a mix of plain accounts, contracts and storage
+	srcdb, _ := ethdb.NewMemDatabase()
+	src, _ := New(common.Hash{}, NewDatabase(srcdb))
+	for i := byte(0); i < 64; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		src.AddBalance(addr, big.NewInt(int64(i)+1))
+		src.SetNonce(addr, uint64(i))
+		if i%4 == 0 {
+			src.SetCode(addr, []byte{i, i, i})
+			for j := byte(1); j <= i; j++ {
+				src.SetState(addr, common.BytesToHash([]byte{j}), common.BytesToHash([]byte{i, j}))
+			}
+		}
+	}
+	root, _ := src.Commit(false)
+	if err := src.Database().TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to commit source state: %v", err)
+	}
+	src, _ = New(root, NewDatabase(srcdb))
+
+	// Export the state and import it into a new database
+	dump := new(bytes.Buffer)
+	accounts, slots, err := src.ExportDump(dump)
+	if err != nil {
+		t.Fatalf("failed to export state: %v", err)
+	}
+	if accounts != 64 || slots != 480 {
+		t.Errorf("export count mismatch: have %d accounts and %d slots", accounts, slots)
+	}
+	dstdb, _ := ethdb.NewMemDatabase()
+	imported, err := ImportDump(dstdb, bytes.NewReader(dump.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to import state: %v", err)
+	}
+	if imported != root {
+		t.Fatalf("imported root mismatch: have %x, want %x", imported, root)
+	}
+	dst, err := New(root, NewDatabase(dstdb))
+	if err != nil {
+		t.Fatalf("failed to open imported state: %v", err)
+	}
+	if have, want := dst.RawDump(), src.RawDump(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("imported state mismatch:\nhave %+v\nwant %+v", have, want)
+	}
+	// Ensure a truncated dump is rejected
+	dstdb, _ = ethdb.NewMemDatabase()
+	if _, err := ImportDump(dstdb, bytes.NewReader(dump.Bytes()[:dump.Len()/2])); err == nil {
+		t.Fatalf("truncated dump imported")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TxLifecycle is the kind of a state change of a transaction within the pool.
+type TxLifecycle string
+
+const (
+	TxAdded    TxLifecycle = "add"     // Transaction entered the future queue
+	TxPromoted TxLifecycle = "promote" // Transaction moved from the queue to the pending set
+	TxDemoted  TxLifecycle = "demote"  // Transaction moved from the pending set back to the queue
+	TxReplaced TxLifecycle = "replace" // Transaction replaced another one with the same nonce
+	TxDropped  TxLifecycle = "drop"    // Transaction was removed from the pool
+)
+
+// TxDropReason is the reason a transaction was removed from the pool.
+type TxDropReason string
+
+const (
+	TxDropUnderpriced TxDropReason = "underpriced" // Priced out by the pool filling up or the price limit rising
+	TxDropReplaced    TxDropReason = "replaced"    // Lost to a better priced transaction with the same nonce
+	TxDropEvicted     TxDropReason = "evicted"     // Exceeded the account or global slot and queue limits
+	TxDropExpired     TxDropReason = "expired"     // Queued for longer than the configured lifetime
+	TxDropIncluded    TxDropReason = "included"    // Included in a block of the new canonical chain
+	TxDropReorged     TxDropReason = "reorged"     // Nonce became too low by a reorg of the chain
+	TxDropStale       TxDropReason = "stale"       // Nonce became too low by another transaction of the sender
+	TxDropUnpayable   TxDropReason = "unpayable"   // Sender can't pay for it any more, or it exceeds the block gas limit
+)
+
+// TxDrop records when and why a transaction was removed from the pool.
+type TxDrop struct {
+	Reason TxDropReason
+	Time   time.Time
+}
+
+// txDropHistory is a bounded record of the most recently dropped transactions,
+// forgetting the oldest drops first.
+type txDropHistory struct {
+	limit int                     // Maximum number of drops to remember
+	drops map[common.Hash]*TxDrop // Drop records by transaction hash
+	order []common.Hash           // Hashes of the recorded drops, oldest first
+}
+
+// newTxDropHistory creates a drop history remembering up to limit transactions.
+func newTxDropHistory(limit int) *txDropHistory {
+	return &txDropHistory{
+		limit: limit,
+		drops: make(map[common.Hash]*TxDrop),
+	}
+}
+
+// add records the drop of a transaction, forgetting the oldest drop if the
+// history is full. Repeated drops of a transaction update its record.
+func (h *txDropHistory) add(hash common.Hash, reason TxDropReason) {
+	if h.limit <= 0 {
+		return
+	}
+	if drop, ok := h.drops[hash]; ok {
+		drop.Reason, drop.Time = reason, time.Now()
+		return
+	}
+	if len(h.order) >= h.limit {
+		delete(h.drops, h.order[0])
+		h.order = h.order[1:]
+	}
+	h.drops[hash] = &TxDrop{Reason: reason, Time: time.Now()}
+	h.order = append(h.order, hash)
+}
+
+// get retrieves the drop record of a transaction, if still remembered.
+func (h *txDropHistory) get(hash common.Hash) *TxDrop {
+	if drop, ok := h.drops[hash]; ok {
+		cpy := *drop
+		return &cpy
+	}
+	return nil
+}
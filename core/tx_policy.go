@@ -0,0 +1,257 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	// ErrSenderNotAllowed is returned if the sender of a transaction is rejected
+	// by the admission policy of the transaction pool.
+	ErrSenderNotAllowed = errors.New("sender not allowed by policy")
+
+	// ErrRecipientNotAllowed is returned if the recipient of a transaction is
+	// rejected by the admission policy of the transaction pool.
+	ErrRecipientNotAllowed = errors.New("recipient not allowed by policy")
+
+	// ErrMethodNotAllowed is returned if the contract method called by a
+	// transaction is rejected by the admission policy of the transaction pool.
+	ErrMethodNotAllowed = errors.New("method not allowed by policy")
+
+	// ErrSenderRateLimited is returned if the sender of a transaction exceeded
+	// the number of transactions the admission policy accepts in a time window.
+	ErrSenderRateLimited = errors.New("sender rate limited by policy")
+)
+
+// DefaultTxPolicyRateWindow is the time window of the per sender rate limit if
+// a limit is configured without one.
+const DefaultTxPolicyRateWindow = time.Minute
+
+// TxPolicy is an admission policy of the transaction pool, deciding whether a
+// transaction passing the basic validity checks may enter the pool. It is
+// consulted for both local and remote transactions, with the pool lock held.
+type TxPolicy interface {
+	// Admit returns an error if the transaction sent by the given account must
+	// be rejected. Local is set if the transaction is local to the node.
+	Admit(tx *types.Transaction, from common.Address, local bool) error
+
+	// RateLimited returns an error if the given account exceeded the rate of
+	// transactions it may insert into the pool. It is not consulted for the
+	// transactions reinjected after a chain reorganisation.
+	RateLimited(from common.Address) error
+
+	// Inserted notifies the policy that a transaction sent by the given account
+	// was inserted into the pool. It is not called for the transactions
+	// reinjected after a chain reorganisation.
+	Inserted(from common.Address)
+}
+
+// MethodSelector is the 4 byte identifier of a contract method, prefixing the
+// input data of transactions calling it.
+type MethodSelector [4]byte
+
+// MarshalText implements encoding.TextMarshaler.
+func (s MethodSelector) MarshalText() ([]byte, error) {
+	return hexutil.Bytes(s[:]).MarshalText()
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *MethodSelector) UnmarshalText(input []byte) error {
+	var selector hexutil.Bytes
+	if err := selector.UnmarshalText(input); err != nil {
+		return err
+	}
+	if len(selector) != len(s) {
+		return fmt.Errorf("invalid method selector length %d", len(selector))
+	}
+	copy(s[:], selector)
+	return nil
+}
+
+// TxPolicyConfig are the rules of the built in transaction pool admission
+// policy. Empty allow lists permit everything not explicitly denied.
+type TxPolicyConfig struct {
+	AllowSenders    []common.Address `json:"allowSenders,omitempty"`    // Senders permitted to submit transactions
+	DenySenders     []common.Address `json:"denySenders,omitempty"`     // Senders rejected regardless of the allow list
+	AllowRecipients []common.Address `json:"allowRecipients,omitempty"` // Recipients permitted to be called (contract creations are not affected)
+	DenyRecipients  []common.Address `json:"denyRecipients,omitempty"`  // Recipients rejected regardless of the allow list
+	AllowMethods    []MethodSelector `json:"allowMethods,omitempty"`    // Contract methods permitted to be called by transactions with input data
+	DenyMethods     []MethodSelector `json:"denyMethods,omitempty"`     // Contract methods rejected regardless of the allow list
+
+	RateLimit  uint64        `json:"rateLimit,omitempty"`  // Maximum number of transactions admitted per sender within the rate window (0 = unlimited)
+	RateWindow time.Duration `json:"rateWindow,omitempty"` // Time window of the per sender rate limit
+}
+
+// empty returns whether the configuration has no rules at all.
+func (config *TxPolicyConfig) empty() bool {
+	return len(config.AllowSenders) == 0 && len(config.DenySenders) == 0 &&
+		len(config.AllowRecipients) == 0 && len(config.DenyRecipients) == 0 &&
+		len(config.AllowMethods) == 0 && len(config.DenyMethods) == 0 &&
+		config.RateLimit == 0
+}
+
+// rateWindow is the number of transactions admitted from a sender within the
+// current rate limiting window.
+type rateWindow struct {
+	start time.Time
+	count uint64
+}
+
+// TxRulePolicy is the built in transaction pool admission policy, filtering
+// transactions by sender, recipient and called method, and limiting the rate
+// of transactions admitted from each sender.
+type TxRulePolicy struct {
+	config TxPolicyConfig
+
+	allowSenders    map[common.Address]struct{}
+	denySenders     map[common.Address]struct{}
+	allowRecipients map[common.Address]struct{}
+	denyRecipients  map[common.Address]struct{}
+	allowMethods    map[MethodSelector]struct{}
+	denyMethods     map[MethodSelector]struct{}
+
+	windows map[common.Address]*rateWindow // Rate limiting windows of the senders
+	swept   time.Time                      // Last time expired windows were dropped
+}
+
+// NewTxRulePolicy creates a transaction pool admission policy enforcing the
+// given rules.
+func NewTxRulePolicy(config TxPolicyConfig) *TxRulePolicy {
+	if config.RateLimit > 0 && config.RateWindow <= 0 {
+		log.Warn("Sanitizing invalid txpool policy rate window", "provided", config.RateWindow, "updated", DefaultTxPolicyRateWindow)
+		config.RateWindow = DefaultTxPolicyRateWindow
+	}
+	policy := &TxRulePolicy{
+		config:          config,
+		allowSenders:    make(map[common.Address]struct{}),
+		denySenders:     make(map[common.Address]struct{}),
+		allowRecipients: make(map[common.Address]struct{}),
+		denyRecipients:  make(map[common.Address]struct{}),
+		allowMethods:    make(map[MethodSelector]struct{}),
+		denyMethods:     make(map[MethodSelector]struct{}),
+		windows:         make(map[common.Address]*rateWindow),
+	}
+	for _, addr := range config.AllowSenders {
+		policy.allowSenders[addr] = struct{}{}
+	}
+	for _, addr := range config.DenySenders {
+		policy.denySenders[addr] = struct{}{}
+	}
+	for _, addr := range config.AllowRecipients {
+		policy.allowRecipients[addr] = struct{}{}
+	}
+	for _, addr := range config.DenyRecipients {
+		policy.denyRecipients[addr] = struct{}{}
+	}
+	for _, method := range config.AllowMethods {
+		policy.allowMethods[method] = struct{}{}
+	}
+	for _, method := range config.DenyMethods {
+		policy.denyMethods[method] = struct{}{}
+	}
+	return policy
+}
+
+// Config returns the rules enforced by the policy.
+func (policy *TxRulePolicy) Config() TxPolicyConfig {
+	return policy.config
+}
+
+// Admit implements TxPolicy, checking the transaction against the configured
+// sender, recipient and method lists.
+func (policy *TxRulePolicy) Admit(tx *types.Transaction, from common.Address, local bool) error {
+	if !listed(policy.allowSenders, policy.denySenders, from) {
+		return ErrSenderNotAllowed
+	}
+	if to := tx.To(); to != nil {
+		if !listed(policy.allowRecipients, policy.denyRecipients, *to) {
+			return ErrRecipientNotAllowed
+		}
+		if data := tx.Data(); len(data) > 0 {
+			var method MethodSelector
+			known := copy(method[:], data) == len(method) // shorter input has no selector
+
+			_, denied := policy.denyMethods[method]
+			_, allowed := policy.allowMethods[method]
+			if (known && denied) || (len(policy.allowMethods) > 0 && !(known && allowed)) {
+				return ErrMethodNotAllowed
+			}
+		}
+	}
+	return nil
+}
+
+// RateLimited implements TxPolicy, checking whether the sender already inserted
+// the configured number of transactions within its current rate window.
+func (policy *TxRulePolicy) RateLimited(from common.Address) error {
+	if policy.config.RateLimit == 0 {
+		return nil
+	}
+	if window := policy.window(from); window.count >= policy.config.RateLimit {
+		return ErrSenderRateLimited
+	}
+	return nil
+}
+
+// Inserted implements TxPolicy, counting the transaction towards the rate limit
+// of its sender.
+func (policy *TxRulePolicy) Inserted(from common.Address) {
+	if policy.config.RateLimit == 0 {
+		return
+	}
+	policy.window(from).count++
+}
+
+// window retrieves the current rate limiting window of a sender, starting a new
+// one if the previous expired.
+func (policy *TxRulePolicy) window(from common.Address) *rateWindow {
+	// Drop the expired windows every now and then to avoid leaking memory
+	if time.Since(policy.swept) >= policy.config.RateWindow {
+		for addr, window := range policy.windows {
+			if time.Since(window.start) >= policy.config.RateWindow {
+				delete(policy.windows, addr)
+			}
+		}
+		policy.swept = time.Now()
+	}
+	window := policy.windows[from]
+	if window == nil || time.Since(window.start) >= policy.config.RateWindow {
+		window = &rateWindow{start: time.Now()}
+		policy.windows[from] = window
+	}
+	return window
+}
+
+// listed returns whether an address is permitted by an allow and a deny list.
+func listed(allow, deny map[common.Address]struct{}, addr common.Address) bool {
+	if _, ok := deny[addr]; ok {
+		return false
+	}
+	if len(allow) == 0 {
+		return true
+	}
+	_, ok := allow[addr]
+	return ok
+}
@@ -40,6 +40,9 @@ const (
 	chainHeadChanSize = 10
 	// rmTxChanSize is the size of channel listening to RemovedTransactionEvent.
 	rmTxChanSize = 10
+	// txEventQueueLimit is the maximum number of lifecycle events waiting to be
+	// delivered, older ones are dropped if subscribers can't keep up.
+	txEventQueueLimit = 4096
 )
 
 var (
@@ -101,6 +104,9 @@ var (
 	// General tx metrics
 	invalidTxCounter     = metrics.NewCounter("txpool/invalid")
 	underpricedTxCounter = metrics.NewCounter("txpool/underpriced")
+
+	// Lifecycle events dropped due to lagging subscribers
+	lifecycleDropCounter = metrics.NewCounter("txpool/lifecycle/drop")
 )
 
 // TxStatus is the current status of a transaction as seen by the pool.
@@ -129,6 +135,9 @@ type TxPoolConfig struct {
 	Journal   string        // Journal of local transactions to survive node restarts
 	Rejournal time.Duration // Time interval to regenerate the local transaction journal
 
+	Snapshot   string        // Snapshot of the entire pool to survive node restarts (disabled if empty)
+	Resnapshot time.Duration // Time interval to regenerate the transaction pool snapshot
+
 	PriceLimit uint64 // Minimum gas price to enforce for acceptance into the pool
 	PriceBump  uint64 // Minimum price bump percentage to replace an already existing transaction (nonce)
 
@@ -138,6 +147,11 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	Policy    TxPolicyConfig // Admission policy rules for transactions entering the pool
+	PolicyAPI bool           // Whether the admission policy may be replaced over RPC (txpool_setPolicy, txpool_clearPolicy)
+
+	DropHistory int // Number of dropped transactions to remember the drop reason of
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -146,6 +160,8 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	Journal:   "transactions.rlp",
 	Rejournal: time.Hour,
 
+	Resnapshot: 10 * time.Minute,
+
 	PriceLimit: 1,
 	PriceBump:  10,
 
@@ -155,6 +171,8 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:  1024,
 
 	Lifetime: 3 * time.Hour,
+
+	DropHistory: 4096,
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -165,6 +183,10 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool journal time", "provided", conf.Rejournal, "updated", time.Second)
 		conf.Rejournal = time.Second
 	}
+	if conf.Resnapshot < time.Second {
+		log.Warn("Sanitizing invalid txpool snapshot time", "provided", conf.Resnapshot, "updated", time.Second)
+		conf.Resnapshot = time.Second
+	}
 	if conf.PriceLimit < 1 {
 		log.Warn("Sanitizing invalid txpool price limit", "provided", conf.PriceLimit, "updated", DefaultTxPoolConfig.PriceLimit)
 		conf.PriceLimit = DefaultTxPoolConfig.PriceLimit
@@ -189,6 +211,7 @@ type TxPool struct {
 	chain        blockChain
 	gasPrice     *big.Int
 	txFeed       event.Feed
+	txEventFeed  event.Feed
 	scope        event.SubscriptionScope
 	chainHeadCh  chan ChainHeadEvent
 	chainHeadSub event.Subscription
@@ -198,19 +221,33 @@ type TxPool struct {
 	currentState  *state.StateDB      // Current state in the blockchain head
 	pendingState  *state.ManagedState // Pending state tracking virtual nonces
 	currentMaxGas uint64              // Current gas limit for transaction caps
+	restoring     bool                // Whether previously accepted transactions are being re-added
+
+	included map[common.Hash]bool // Transactions included by the chain segment being reset to
+	reorging bool                 // Whether the chain segment being reset to replaced old blocks
 
-	locals  *accountSet // Set of local transaction to exempt from eviction rules
-	journal *txJournal  // Journal of local transaction to back up to disk
+	locals   *accountSet // Set of local transaction to exempt from eviction rules
+	policy   TxPolicy    // Admission policy of transactions entering the pool (optional)
+	journal  *txJournal  // Journal of local transaction to back up to disk
+	snapshot *txSnapshot // Snapshot of all the transactions to back up to disk
 
 	pending map[common.Address]*txList         // All currently processable transactions
 	queue   map[common.Address]*txList         // Queued but non-processable transactions
 	beats   map[common.Address]time.Time       // Last heartbeat from each known account
 	all     map[common.Hash]*types.Transaction // All transactions to allow lookups
+	arrived map[common.Hash]time.Time          // Arrival time of each known transaction
 	priced  *txPricedList                      // All transactions sorted by price
+	drops   *txDropHistory                     // Reasons of the recently dropped transactions
+
+	events    []TxLifecycleEvent // Lifecycle events waiting to be delivered
+	eventsMu  sync.Mutex         // Mutex protecting the undelivered events
+	eventWake chan struct{}      // Notification channel of new lifecycle events
+	eventQuit chan struct{}      // Termination channel of the event delivery loop
 
 	wg sync.WaitGroup // for shutdown sync
 
 	homestead bool
+	istanbul  bool
 }
 
 // NewTxPool creates a new transaction pool to gather, sort and filter inbound
@@ -229,30 +266,51 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		queue:       make(map[common.Address]*txList),
 		beats:       make(map[common.Address]time.Time),
 		all:         make(map[common.Hash]*types.Transaction),
+		arrived:     make(map[common.Hash]time.Time),
+		drops:       newTxDropHistory(config.DropHistory),
+		eventWake:   make(chan struct{}, 1),
+		eventQuit:   make(chan struct{}),
 		chainHeadCh: make(chan ChainHeadEvent, chainHeadChanSize),
 		gasPrice:    new(big.Int).SetUint64(config.PriceLimit),
 	}
 	pool.locals = newAccountSet(pool.signer)
 	pool.priced = newTxPricedList(&pool.all)
+	if !config.Policy.empty() {
+		pool.policy = NewTxRulePolicy(config.Policy)
+	}
 	pool.reset(nil, chain.CurrentBlock().Header())
 
 	// If local transactions and journaling is enabled, load from disk
 	if !config.NoLocals && config.Journal != "" {
 		pool.journal = newTxJournal(config.Journal)
 
+		pool.restoring = true
 		if err := pool.journal.load(pool.AddLocal); err != nil {
 			log.Warn("Failed to load transaction journal", "err", err)
 		}
+		pool.restoring = false
+
 		if err := pool.journal.rotate(pool.local()); err != nil {
 			log.Warn("Failed to rotate transaction journal", "err", err)
 		}
 	}
+	// If the full pool snapshot is enabled, reload it on top of the current head
+	if config.Snapshot != "" {
+		pool.snapshot = newTxSnapshot(config.Snapshot)
+
+		accounts, err := pool.snapshot.load()
+		if err != nil {
+			log.Warn("Failed to load transaction pool snapshot", "err", err)
+		}
+		pool.restore(accounts)
+	}
 	// Subscribe events from blockchain
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
 
 	// Start the event loop and return
-	pool.wg.Add(1)
+	pool.wg.Add(2)
 	go pool.loop()
+	go pool.eventLoop()
 
 	return pool
 }
@@ -275,6 +333,9 @@ func (pool *TxPool) loop() {
 	journal := time.NewTicker(pool.config.Rejournal)
 	defer journal.Stop()
 
+	snapshot := time.NewTicker(pool.config.Resnapshot)
+	defer snapshot.Stop()
+
 	// Track the previous head headers for transaction reorgs
 	head := pool.chain.CurrentBlock()
 
@@ -285,9 +346,6 @@ func (pool *TxPool) loop() {
 		case ev := <-pool.chainHeadCh:
 			if ev.Block != nil {
 				pool.mu.Lock()
-				if pool.chainconfig.IsHomestead(ev.Block.Number()) {
-					pool.homestead = true
-				}
 				pool.reset(head.Header(), ev.Block.Header())
 				head = ev.Block
 
@@ -320,7 +378,7 @@ func (pool *TxPool) loop() {
 				// Any non-locals old enough should be removed
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
 					for _, tx := range pool.queue[addr].Flatten() {
-						pool.removeTx(tx.Hash())
+						pool.removeTx(tx.Hash(), TxDropExpired)
 					}
 				}
 			}
@@ -335,6 +393,39 @@ func (pool *TxPool) loop() {
 				}
 				pool.mu.Unlock()
 			}
+
+		// Handle full transaction pool snapshot regeneration
+		case <-snapshot.C:
+			if pool.snapshot != nil {
+				pool.mu.RLock()
+				if err := pool.snapshot.save(pool.dump()); err != nil {
+					log.Warn("Failed to store tx pool snapshot", "err", err)
+				}
+				pool.mu.RUnlock()
+			}
+		}
+	}
+}
+
+// eventLoop delivers the transaction lifecycle events to the subscribers in
+// order. It runs separately from the main loop, so that slow subscribers can't
+// stall the pool, only lose events if they lag behind too much.
+func (pool *TxPool) eventLoop() {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case <-pool.eventWake:
+			pool.eventsMu.Lock()
+			events := pool.events
+			pool.events = nil
+			pool.eventsMu.Unlock()
+
+			for _, ev := range events {
+				pool.txEventFeed.Send(ev)
+			}
+		case <-pool.eventQuit:
+			return
 		}
 	}
 }
@@ -352,9 +443,10 @@ func (pool *TxPool) lockedReset(oldHead, newHead *types.Header) {
 // of the transaction pool is valid with regard to the chain state.
 func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// If we're reorging an old state, reinject all dropped transactions
-	var reinject types.Transactions
+	var reinject, included types.Transactions
 
-	if oldHead != nil && oldHead.Hash() != newHead.ParentHash {
+	reorg := oldHead != nil && oldHead.Hash() != newHead.ParentHash
+	if reorg {
 		// If the reorg is too deep, avoid doing it (will happen during fast sync)
 		oldNum := oldHead.Number.Uint64()
 		newNum := newHead.Number.Uint64()
@@ -363,7 +455,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 			log.Debug("Skipping deep transaction reorg", "depth", depth)
 		} else {
 			// Reorg seems shallow enough to pull in all transactions into memory
-			var discarded, included types.Transactions
+			var discarded types.Transactions
 
 			var (
 				rem = pool.chain.GetBlock(oldHead.Hash(), oldHead.Number.Uint64())
@@ -397,6 +489,10 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 			}
 			reinject = types.TxDifference(discarded, included)
 		}
+	} else if oldHead != nil {
+		if block := pool.chain.GetBlock(newHead.Hash(), newHead.Number.Uint64()); block != nil {
+			included = block.Transactions()
+		}
 	}
 	// Initialize the internal state to the current head
 	if newHead == nil {
@@ -411,9 +507,24 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	pool.pendingState = state.ManageState(statedb)
 	pool.currentMaxGas = newHead.GasLimit
 
+	// Update the fork rules to those of the next block to be mined
+	next := new(big.Int).Add(newHead.Number, big.NewInt(1))
+	pool.homestead = pool.chainconfig.IsHomestead(next)
+	pool.istanbul = pool.chainconfig.IsIstanbul(next)
+
 	// Inject any transactions discarded due to reorgs
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
+	pool.restoring = true
 	pool.addTxsLocked(reinject, false)
+	pool.restoring = false
+
+	// Track the transactions of the new chain segment, so that those leaving the
+	// pool due to their nonce can be reported as included or reorged out
+	pool.included = make(map[common.Hash]bool, len(included))
+	for _, tx := range included {
+		pool.included[tx.Hash()] = true
+	}
+	pool.reorging = reorg
 
 	// validate the pool of pending transactions, this will remove
 	// any transactions that have been included in the block or
@@ -429,12 +540,15 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// Check the queue and move transactions over to the pending if possible
 	// or remove those that have become invalid
 	pool.promoteExecutables(nil)
+
+	pool.included, pool.reorging = nil, false
 }
 
 // Stop terminates the transaction pool.
 func (pool *TxPool) Stop() {
 	// Unsubscribe all subscriptions registered from txpool
 	pool.scope.Close()
+	close(pool.eventQuit)
 
 	// Unsubscribe subscriptions registered from blockchain
 	pool.chainHeadSub.Unsubscribe()
@@ -443,6 +557,13 @@ func (pool *TxPool) Stop() {
 	if pool.journal != nil {
 		pool.journal.close()
 	}
+	if pool.snapshot != nil {
+		pool.mu.RLock()
+		if err := pool.snapshot.save(pool.dump()); err != nil {
+			log.Warn("Failed to store tx pool snapshot", "err", err)
+		}
+		pool.mu.RUnlock()
+	}
 	log.Info("Transaction pool stopped")
 }
 
@@ -452,6 +573,12 @@ func (pool *TxPool) SubscribeTxPreEvent(ch chan<- TxPreEvent) event.Subscription
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribeTxLifecycleEvent registers a subscription of TxLifecycleEvent and
+// starts sending event to the given channel.
+func (pool *TxPool) SubscribeTxLifecycleEvent(ch chan<- TxLifecycleEvent) event.Subscription {
+	return pool.scope.Track(pool.txEventFeed.Subscribe(ch))
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -468,11 +595,31 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 
 	pool.gasPrice = price
 	for _, tx := range pool.priced.Cap(price, pool.locals) {
-		pool.removeTx(tx.Hash())
+		pool.removeTx(tx.Hash(), TxDropUnderpriced)
 	}
 	log.Info("Transaction pool price threshold updated", "price", price)
 }
 
+// Policy returns the admission policy enforced by the transaction pool, or nil
+// if every valid transaction is accepted.
+func (pool *TxPool) Policy() TxPolicy {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.policy
+}
+
+// SetPolicy replaces the admission policy of the transaction pool, applying it
+// to all transactions entering the pool from now on. A nil policy accepts every
+// valid transaction.
+func (pool *TxPool) SetPolicy(policy TxPolicy) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.policy = policy
+	log.Info("Transaction pool admission policy updated", "enabled", policy != nil)
+}
+
 // State returns the virtual managed state of the transaction pool.
 func (pool *TxPool) State() *state.ManagedState {
 	pool.mu.RLock()
@@ -551,6 +698,84 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 	return txs
 }
 
+// dump retrieves the entire content of the pool along with the account heartbeats
+// to store in a snapshot.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) dump() []*txSnapshotAccount {
+	accounts := make(map[common.Address]*txSnapshotAccount)
+	account := func(addr common.Address) *txSnapshotAccount {
+		if accounts[addr] == nil {
+			accounts[addr] = &txSnapshotAccount{Address: addr, Local: pool.locals.contains(addr)}
+			if beat := pool.beats[addr]; !beat.IsZero() {
+				accounts[addr].Beat = uint64(beat.UnixNano())
+			}
+		}
+		return accounts[addr]
+	}
+	for addr, list := range pool.pending {
+		account(addr).Pending = list.Flatten()
+	}
+	for addr, list := range pool.queue {
+		account(addr).Queued = list.Flatten()
+	}
+	dump := make([]*txSnapshotAccount, 0, len(accounts))
+	for _, account := range accounts {
+		dump = append(dump, account)
+	}
+	return dump
+}
+
+// restore injects the content of a pool snapshot, validating every transaction
+// against the current head. Invalidated transactions are dropped, as are the
+// queued ones of remote accounts which would have been evicted in the meantime.
+func (pool *TxPool) restore(accounts []*txSnapshotAccount) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var (
+		locals, remotes types.Transactions
+		total, dropped  int
+	)
+	for _, account := range accounts {
+		total += len(account.Pending) + len(account.Queued)
+
+		txs := append(types.Transactions{}, account.Pending...)
+		if !account.Local && account.Beat != 0 && time.Since(time.Unix(0, int64(account.Beat))) > pool.config.Lifetime {
+			dropped += len(account.Queued)
+		} else {
+			txs = append(txs, account.Queued...)
+		}
+		if account.Local && !pool.config.NoLocals {
+			locals = append(locals, txs...)
+		} else {
+			remotes = append(remotes, txs...)
+		}
+	}
+	pool.restoring = true
+	errs := [][]error{pool.addTxsLocked(locals, true), pool.addTxsLocked(remotes, false)}
+	pool.restoring = false
+
+	for _, errs := range errs {
+		for _, err := range errs {
+			if err != nil {
+				log.Debug("Failed to add snapshotted transaction", "err", err)
+				dropped++
+			}
+		}
+	}
+	// Restore the heartbeats of the accounts still present in the pool
+	for _, account := range accounts {
+		if account.Beat == 0 || (pool.pending[account.Address] == nil && pool.queue[account.Address] == nil) {
+			continue
+		}
+		pool.beats[account.Address] = time.Unix(0, int64(account.Beat))
+	}
+	if len(accounts) > 0 {
+		log.Info("Loaded transaction pool snapshot", "transactions", total, "dropped", dropped)
+	}
+}
+
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
@@ -586,13 +811,24 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if pool.currentState.GetBalance(from).Cmp(tx.Cost()) < 0 {
 		return ErrInsufficientFunds
 	}
-	intrGas, err := IntrinsicGas(tx.Data(), tx.To() == nil, pool.homestead)
+	intrGas, err := IntrinsicGas(tx.Data(), tx.To() == nil, pool.homestead, pool.istanbul)
 	if err != nil {
 		return err
 	}
 	if tx.Gas() < intrGas {
 		return ErrIntrinsicGas
 	}
+	// Ensure the transaction is admitted by the configured policy
+	if pool.policy != nil {
+		if err := pool.policy.Admit(tx, from, local); err != nil {
+			return err
+		}
+		if !pool.restoring {
+			if err := pool.policy.RateLimited(from); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -630,7 +866,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		for _, tx := range drop {
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "price", tx.GasPrice())
 			underpricedTxCounter.Inc(1)
-			pool.removeTx(tx.Hash())
+			pool.removeTx(tx.Hash(), TxDropUnderpriced)
 		}
 	}
 	// If the transaction is replacing an already pending one, do directly
@@ -647,10 +883,15 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 			delete(pool.all, old.Hash())
 			pool.priced.Removed()
 			pendingReplaceCounter.Inc(1)
+
+			pool.dropped(old.Hash(), TxDropReplaced)
+			pool.emit(TxLifecycleEvent{Hash: hash, Kind: TxReplaced, Replaced: old.Hash()})
 		}
 		pool.all[tx.Hash()] = tx
+		pool.arrived[tx.Hash()] = time.Now()
 		pool.priced.Put(tx)
 		pool.journalTx(from, tx)
+		pool.inserted(from)
 
 		log.Trace("Pooled new executable transaction", "hash", hash, "from", from, "to", tx.To())
 
@@ -664,6 +905,11 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if !replace {
+		pool.emit(TxLifecycleEvent{Hash: hash, Kind: TxAdded})
+	}
+	pool.arrived[hash] = time.Now()
+	pool.inserted(from)
 	// Mark local addresses and journal local transactions
 	if local {
 		pool.locals.add(from)
@@ -674,6 +920,16 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 	return replace, nil
 }
 
+// inserted reports a transaction newly inserted into the pool to the admission
+// policy, unless it was only re-added after a reorg or a restart.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) inserted(from common.Address) {
+	if pool.policy != nil && !pool.restoring {
+		pool.policy.Inserted(from)
+	}
+}
+
 // enqueueTx inserts a new transaction into the non-executable transaction queue.
 //
 // Note, this method assumes the pool lock is held!
@@ -694,9 +950,15 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 		delete(pool.all, old.Hash())
 		pool.priced.Removed()
 		queuedReplaceCounter.Inc(1)
+
+		pool.dropped(old.Hash(), TxDropReplaced)
+		pool.emit(TxLifecycleEvent{Hash: hash, Kind: TxReplaced, Replaced: old.Hash()})
+	}
+	// Demoted transactions are already tracked, don't price them twice
+	if pool.all[hash] == nil {
+		pool.all[hash] = tx
+		pool.priced.Put(tx)
 	}
-	pool.all[hash] = tx
-	pool.priced.Put(tx)
 	return old != nil, nil
 }
 
@@ -729,6 +991,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.priced.Removed()
 
 		pendingDiscardCounter.Inc(1)
+		pool.dropped(hash, TxDropReplaced)
 		return
 	}
 	// Otherwise discard any previous transaction and mark this
@@ -737,6 +1000,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.priced.Removed()
 
 		pendingReplaceCounter.Inc(1)
+		pool.dropped(old.Hash(), TxDropReplaced)
 	}
 	// Failsafe to work around direct pending inserts (tests)
 	if pool.all[hash] == nil {
@@ -747,6 +1011,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 	pool.beats[addr] = time.Now()
 	pool.pendingState.SetNonce(addr, tx.Nonce()+1)
 
+	pool.emit(TxLifecycleEvent{Hash: hash, Kind: TxPromoted})
 	go pool.txFeed.Send(TxPreEvent{tx})
 }
 
@@ -860,9 +1125,70 @@ func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
 	return pool.all[hash]
 }
 
+// ArrivalTime returns when a transaction was accepted into the pool, or the zero
+// time if it isn't known.
+func (pool *TxPool) ArrivalTime(hash common.Hash) time.Time {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.arrived[hash]
+}
+
+// DropReason returns when and why a transaction was removed from the pool, or
+// nil if it wasn't dropped recently.
+func (pool *TxPool) DropReason(hash common.Hash) *TxDrop {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.drops.get(hash)
+}
+
+// dropped records the removal of a transaction from the pool and notifies the
+// lifecycle event subscribers.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) dropped(hash common.Hash, reason TxDropReason) {
+	delete(pool.arrived, hash)
+	pool.drops.add(hash, reason)
+	pool.emit(TxLifecycleEvent{Hash: hash, Kind: TxDropped, Reason: reason})
+}
+
+// emit queues a transaction lifecycle event for in order delivery by the event
+// loop, without blocking on the subscribers.
+func (pool *TxPool) emit(ev TxLifecycleEvent) {
+	pool.eventsMu.Lock()
+	if len(pool.events) >= txEventQueueLimit {
+		pool.events = pool.events[1:]
+		lifecycleDropCounter.Inc(1)
+	}
+	pool.events = append(pool.events, ev)
+	pool.eventsMu.Unlock()
+
+	select {
+	case pool.eventWake <- struct{}{}:
+	default:
+	}
+}
+
+// staleReason returns why a transaction with a too low nonce is removed from the
+// pool: it was included in the chain, or its nonce was taken by a reorg or by
+// another transaction of the same sender.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) staleReason(hash common.Hash) TxDropReason {
+	switch {
+	case pool.included[hash]:
+		return TxDropIncluded
+	case pool.reorging:
+		return TxDropReorged
+	default:
+		return TxDropStale
+	}
+}
+
 // removeTx removes a single transaction from the queue, moving all subsequent
 // transactions back to the future queue.
-func (pool *TxPool) removeTx(hash common.Hash) {
+func (pool *TxPool) removeTx(hash common.Hash, reason TxDropReason) {
 	// Fetch the transaction we wish to delete
 	tx, ok := pool.all[hash]
 	if !ok {
@@ -873,6 +1199,7 @@ func (pool *TxPool) removeTx(hash common.Hash) {
 	// Remove it from the list of known transactions
 	delete(pool.all, hash)
 	pool.priced.Removed()
+	pool.dropped(hash, reason)
 
 	// Remove the transaction from the pending lists and reset the account nonce
 	if pending := pool.pending[addr]; pending != nil {
@@ -881,11 +1208,11 @@ func (pool *TxPool) removeTx(hash common.Hash) {
 			if pending.Empty() {
 				delete(pool.pending, addr)
 				delete(pool.beats, addr)
-			} else {
-				// Otherwise postpone any invalidated transactions
-				for _, tx := range invalids {
-					pool.enqueueTx(tx.Hash(), tx)
-				}
+			}
+			// Postpone any invalidated transactions
+			for _, tx := range invalids {
+				pool.enqueueTx(tx.Hash(), tx)
+				pool.emit(TxLifecycleEvent{Hash: tx.Hash(), Kind: TxDemoted})
 			}
 			// Update the account nonce if needed
 			if nonce := tx.Nonce(); pool.pendingState.GetNonce(addr) > nonce {
@@ -926,6 +1253,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			log.Trace("Removed old queued transaction", "hash", hash)
 			delete(pool.all, hash)
 			pool.priced.Removed()
+			pool.dropped(hash, pool.staleReason(hash))
 		}
 		// Drop all transactions that are too costly (low balance or out of gas)
 		drops, _ := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas)
@@ -935,6 +1263,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			delete(pool.all, hash)
 			pool.priced.Removed()
 			queuedNofundsCounter.Inc(1)
+			pool.dropped(hash, TxDropUnpayable)
 		}
 		// Gather all executable transactions and promote them
 		for _, tx := range list.Ready(pool.pendingState.GetNonce(addr)) {
@@ -949,6 +1278,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 				delete(pool.all, hash)
 				pool.priced.Removed()
 				queuedRateLimitCounter.Inc(1)
+				pool.dropped(hash, TxDropEvicted)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
 		}
@@ -993,6 +1323,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 							hash := tx.Hash()
 							delete(pool.all, hash)
 							pool.priced.Removed()
+							pool.dropped(hash, TxDropEvicted)
 
 							// Update the account nonce to the dropped transaction
 							if nonce := tx.Nonce(); pool.pendingState.GetNonce(offenders[i]) > nonce {
@@ -1015,6 +1346,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 						hash := tx.Hash()
 						delete(pool.all, hash)
 						pool.priced.Removed()
+						pool.dropped(hash, TxDropEvicted)
 
 						// Update the account nonce to the dropped transaction
 						if nonce := tx.Nonce(); pool.pendingState.GetNonce(addr) > nonce {
@@ -1053,7 +1385,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			// Drop all transactions if they are less than the overflow
 			if size := uint64(list.Len()); size <= drop {
 				for _, tx := range list.Flatten() {
-					pool.removeTx(tx.Hash())
+					pool.removeTx(tx.Hash(), TxDropEvicted)
 				}
 				drop -= size
 				queuedRateLimitCounter.Inc(int64(size))
@@ -1062,7 +1394,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			// Otherwise drop only last few transactions
 			txs := list.Flatten()
 			for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
-				pool.removeTx(txs[i].Hash())
+				pool.removeTx(txs[i].Hash(), TxDropEvicted)
 				drop--
 				queuedRateLimitCounter.Inc(1)
 			}
@@ -1084,6 +1416,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			log.Trace("Removed old pending transaction", "hash", hash)
 			delete(pool.all, hash)
 			pool.priced.Removed()
+			pool.dropped(hash, pool.staleReason(hash))
 		}
 		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
 		drops, invalids := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas)
@@ -1093,11 +1426,13 @@ func (pool *TxPool) demoteUnexecutables() {
 			delete(pool.all, hash)
 			pool.priced.Removed()
 			pendingNofundsCounter.Inc(1)
+			pool.dropped(hash, TxDropUnpayable)
 		}
 		for _, tx := range invalids {
 			hash := tx.Hash()
 			log.Trace("Demoting pending transaction", "hash", hash)
 			pool.enqueueTx(hash, tx)
+			pool.emit(TxLifecycleEvent{Hash: hash, Kind: TxDemoted})
 		}
 		// If there's a gap in front, warn (should never happen) and postpone all transactions
 		if list.Len() > 0 && list.txs.Get(nonce) == nil {
@@ -1105,6 +1440,7 @@ func (pool *TxPool) demoteUnexecutables() {
 				hash := tx.Hash()
 				log.Error("Demoting invalidated transaction", "hash", hash)
 				pool.enqueueTx(hash, tx)
+				pool.emit(TxLifecycleEvent{Hash: hash, Kind: TxDemoted})
 			}
 		}
 		// Delete the entire queue entry if it became empty.
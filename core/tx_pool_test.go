@@ -17,7 +17,9 @@
 package core
 
 import (
+	"bytes"
 	"crypto/ecdsa"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -224,6 +226,37 @@ func TestStateChangeDuringTransactionPoolReset(t *testing.T) {
 	}
 }
 
+// Tests that a pool started on a chain already past Istanbul charges the reduced
+// calldata gas right away, without waiting for a new chain head.
+func TestTransactionIntrinsicGasIstanbul(t *testing.T) {
+	t.Parallel()
+
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := *params.TestChainConfig
+	config.IstanbulBlock = big.NewInt(0)
+
+	pool := NewTxPool(testTxPoolConfig, &config, blockchain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	data := bytes.Repeat([]byte{0xff}, 100)
+	gas := params.TxGas + 100*params.TxDataNonZeroGasEIP2028
+
+	tx, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(0), gas-1, big.NewInt(1), data), types.HomesteadSigner{}, key)
+	if err := pool.AddRemote(tx); err != ErrIntrinsicGas {
+		t.Errorf("short gas error mismatch: have %v, want %v", err, ErrIntrinsicGas)
+	}
+	tx, _ = types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(0), gas, big.NewInt(1), data), types.HomesteadSigner{}, key)
+	if err := pool.AddRemote(tx); err != nil {
+		t.Errorf("failed to add transaction paying Istanbul intrinsic gas: %v", err)
+	}
+}
+
 func TestInvalidTransactions(t *testing.T) {
 	t.Parallel()
 
@@ -350,7 +383,7 @@ func TestTransactionChainFork(t *testing.T) {
 	if _, err := pool.add(tx, false); err != nil {
 		t.Error("didn't expect error", err)
 	}
-	pool.removeTx(tx.Hash())
+	pool.removeTx(tx.Hash(), TxDropEvicted)
 
 	// reset the pool's internal state
 	resetState()
@@ -1563,6 +1596,620 @@ func testTransactionJournaling(t *testing.T, nolocals bool) {
 	pool.Stop()
 }
 
+// Tests that the full pool snapshot restores local and remote, pending and
+// queued transactions along with the account heartbeats, dropping the entries
+// invalidated by the new head.
+func TestTransactionSnapshot(t *testing.T) {
+	t.Parallel()
+
+	// Create a temporary file for the snapshot
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary snapshot: %v", err)
+	}
+	snapshot := file.Name()
+	defer os.Remove(snapshot)
+
+	// Clean up the temporary file, we only need the path for now
+	file.Close()
+	os.Remove(snapshot)
+
+	// Create the original pool to snapshot the transactions of
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.Snapshot = snapshot
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+	stale, _ := crypto.GenerateKey()
+
+	for _, key := range []*ecdsa.PrivateKey{local, remote, stale} {
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	}
+	// Add a pending local, a pending and a queued remote, and a stale queued remote
+	if err := pool.AddLocal(pricedTransaction(0, 100000, big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(1), remote)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(2, 100000, big.NewInt(1), remote)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(1, 100000, big.NewInt(1), stale)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	beat := time.Now().Add(-time.Minute)
+
+	pool.mu.Lock()
+	pool.beats[crypto.PubkeyToAddress(remote.PublicKey)] = beat
+	pool.beats[crypto.PubkeyToAddress(stale.PublicKey)] = time.Now().Add(-2 * config.Lifetime)
+	pool.mu.Unlock()
+
+	pending, queued := pool.Stats()
+	if pending != 2 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 2)
+	}
+	if queued != 2 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 2)
+	}
+	// Terminate the old pool, include the pending remote, and restart from the snapshot
+	pool.Stop()
+	statedb.SetNonce(crypto.PubkeyToAddress(remote.PublicKey), 1)
+	blockchain = &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	pending, queued = pool.Stats()
+	if pending != 1 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 1)
+	}
+	if queued != 1 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 1)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	if pool.pending[crypto.PubkeyToAddress(local.PublicKey)] == nil || !pool.locals.contains(crypto.PubkeyToAddress(local.PublicKey)) {
+		t.Errorf("local transaction not restored as local pending")
+	}
+	if pool.queue[crypto.PubkeyToAddress(remote.PublicKey)] == nil || pool.locals.contains(crypto.PubkeyToAddress(remote.PublicKey)) {
+		t.Errorf("remote transaction not restored as remote queued")
+	}
+	if have := pool.beats[crypto.PubkeyToAddress(remote.PublicKey)]; !have.Equal(beat) {
+		t.Errorf("remote heartbeat mismatch: have %v, want %v", have, beat)
+	}
+}
+
+// Tests that the admission policy configured for the pool is enforced on both
+// local and remote transactions, and that it can be replaced at runtime.
+func TestTransactionPolicy(t *testing.T) {
+	t.Parallel()
+
+	var (
+		allowed  = common.HexToAddress("0xa11e")
+		denied   = common.HexToAddress("0xde11")
+		selector = MethodSelector{0xa9, 0x05, 0x9c, 0xbb}
+	)
+	var methods []MethodSelector
+	if err := json.Unmarshal([]byte(`["0xa9059cbb"]`), &methods); err != nil || len(methods) != 1 || methods[0] != selector {
+		t.Fatalf("failed to unmarshal method selectors: %v, %x", err, methods)
+	}
+	if err := json.Unmarshal([]byte(`["0xa9059c"]`), &methods); err == nil {
+		t.Fatalf("short method selector unmarshalled successfully")
+	}
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	key, _ := crypto.GenerateKey()
+	blocked, _ := crypto.GenerateKey()
+
+	config := testTxPoolConfig
+	config.Policy = TxPolicyConfig{
+		DenySenders:     []common.Address{crypto.PubkeyToAddress(blocked.PublicKey)},
+		AllowRecipients: []common.Address{allowed},
+		AllowMethods:    methods,
+		RateLimit:       2,
+		RateWindow:      time.Hour,
+	}
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(blocked.PublicKey), big.NewInt(1000000000))
+
+	call := func(nonce uint64, to common.Address, data []byte, key *ecdsa.PrivateKey) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(0), 100000, big.NewInt(1), data), types.HomesteadSigner{}, key)
+		return tx
+	}
+	tests := []struct {
+		tx    *types.Transaction
+		local bool
+		err   error
+	}{
+		{call(0, allowed, nil, blocked), false, ErrSenderNotAllowed},
+		{call(0, allowed, nil, blocked), true, ErrSenderNotAllowed},
+		{call(0, denied, nil, key), false, ErrRecipientNotAllowed},
+		{call(0, allowed, []byte{0x01, 0x02, 0x03, 0x04}, key), false, ErrMethodNotAllowed},
+		{call(0, allowed, []byte{0xa9, 0x05}, key), true, ErrMethodNotAllowed},
+		{call(0, allowed, append(selector[:], 0x01), key), false, nil},
+		{call(1, allowed, nil, key), true, nil},
+		{call(2, allowed, nil, key), false, ErrSenderRateLimited},
+	}
+	for i, tt := range tests {
+		var err error
+		if tt.local {
+			err = pool.AddLocal(tt.tx)
+		} else {
+			err = pool.AddRemote(tt.tx)
+		}
+		if err != tt.err {
+			t.Errorf("test %d: admission error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Relax the policy at runtime and ensure previously rejected transactions are accepted
+	pool.SetPolicy(NewTxRulePolicy(TxPolicyConfig{DenyRecipients: []common.Address{denied}}))
+	if err := pool.AddRemote(call(2, allowed, nil, key)); err != nil {
+		t.Errorf("failed to add transaction after policy update: %v", err)
+	}
+	if err := pool.AddRemote(call(0, denied, nil, blocked)); err != ErrRecipientNotAllowed {
+		t.Errorf("denied recipient error mismatch: have %v, want %v", err, ErrRecipientNotAllowed)
+	}
+	pool.SetPolicy(nil)
+	if err := pool.AddRemote(call(0, denied, nil, blocked)); err != nil {
+		t.Errorf("failed to add transaction without policy: %v", err)
+	}
+	if pending, _ := pool.Stats(); pending != 4 {
+		t.Errorf("pending transactions mismatched: have %d, want %d", pending, 4)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the policy rate limit is only charged for transactions actually
+// inserted into the pool, and not for the ones reinjected after a reorg.
+func TestTransactionPolicyRateLimit(t *testing.T) {
+	t.Parallel()
+
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	// A rate limit without a window must fall back to the default one
+	config := testTxPoolConfig
+	config.Policy = TxPolicyConfig{RateLimit: 2}
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	if window := pool.Policy().(*TxRulePolicy).Config().RateWindow; window != DefaultTxPolicyRateWindow {
+		t.Fatalf("rate window mismatch: have %v, want %v", window, DefaultTxPolicyRateWindow)
+	}
+	key, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	// Rejected replacements must not count towards the limit
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(1), key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100001, big.NewInt(1), key)); err != ErrReplaceUnderpriced {
+		t.Fatalf("replacement error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	if err := pool.AddRemote(pricedTransaction(1, 100000, big.NewInt(1), key)); err != nil {
+		t.Fatalf("failed to add transaction after rejected replacement: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(2, 100000, big.NewInt(1), key)); err != ErrSenderRateLimited {
+		t.Fatalf("rate limit error mismatch: have %v, want %v", err, ErrSenderRateLimited)
+	}
+	// Transactions reinjected after a reorg must bypass the limit
+	pool.mu.Lock()
+	pool.restoring = true
+	errs := pool.addTxsLocked(types.Transactions{pricedTransaction(2, 100000, big.NewInt(1), key)}, false)
+	pool.restoring = false
+	pool.mu.Unlock()
+
+	if errs[0] != nil {
+		t.Fatalf("failed to reinject transaction: %v", errs[0])
+	}
+	if err := pool.AddRemote(pricedTransaction(3, 100000, big.NewInt(1), key)); err != ErrSenderRateLimited {
+		t.Fatalf("rate limit error mismatch after reinjection: have %v, want %v", err, ErrSenderRateLimited)
+	}
+	if pending, _ := pool.Stats(); pending != 3 {
+		t.Errorf("pending transactions mismatched: have %d, want %d", pending, 3)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the transactions reloaded from the journal and the pool snapshot on
+// a restart are neither rate limited nor count towards the limit of their senders.
+func TestTransactionPolicyRateLimitRestart(t *testing.T) {
+	t.Parallel()
+
+	// Create temporary files for the journal and the snapshot
+	var paths []string
+	for i := 0; i < 2; i++ {
+		file, err := ioutil.TempFile("", "")
+		if err != nil {
+			t.Fatalf("failed to create temporary file: %v", err)
+		}
+		file.Close()
+		os.Remove(file.Name())
+		defer os.Remove(file.Name())
+
+		paths = append(paths, file.Name())
+	}
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.Journal, config.Snapshot = paths[0], paths[1]
+
+	// Fill an unrestricted pool with more transactions than the limit allows
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+	for _, key := range []*ecdsa.PrivateKey{local, remote} {
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	}
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		if err := pool.AddLocal(pricedTransaction(nonce, 100000, big.NewInt(1), local)); err != nil {
+			t.Fatalf("failed to add local transaction %d: %v", nonce, err)
+		}
+		if err := pool.AddRemote(pricedTransaction(nonce, 100000, big.NewInt(1), remote)); err != nil {
+			t.Fatalf("failed to add remote transaction %d: %v", nonce, err)
+		}
+	}
+	pool.Stop()
+
+	// Restart with a rate limit and ensure everything is reloaded
+	config.Policy = TxPolicyConfig{RateLimit: 1}
+	blockchain = &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	if pending, _ := pool.Stats(); pending != 4 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 4)
+	}
+	// The reloaded transactions must have left the rate limit windows untouched
+	for _, key := range []*ecdsa.PrivateKey{local, remote} {
+		if err := pool.AddRemote(pricedTransaction(2, 100000, big.NewInt(1), key)); err != nil {
+			t.Fatalf("failed to add transaction after restart: %v", err)
+		}
+		if err := pool.AddRemote(pricedTransaction(3, 100000, big.NewInt(1), key)); err != ErrSenderRateLimited {
+			t.Fatalf("rate limit error mismatch after restart: have %v, want %v", err, ErrSenderRateLimited)
+		}
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the pool streams the lifecycle events of transactions in order and
+// remembers why transactions were dropped.
+func TestTransactionLifecycle(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	events := make(chan TxLifecycleEvent, 16)
+	sub := pool.SubscribeTxLifecycleEvent(events)
+	defer sub.Unsubscribe()
+
+	var (
+		tx0 = pricedTransaction(0, 100000, big.NewInt(20), key)
+		tx1 = pricedTransaction(1, 100000, big.NewInt(10), key)
+		rep = pricedTransaction(1, 100000, big.NewInt(12), key)
+	)
+	// Queue a gapped transaction, fill the gap, replace the gapped one and raise the price
+	for _, tx := range []*types.Transaction{tx1, tx0, rep} {
+		if err := pool.AddRemote(tx); err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+	pool.SetGasPrice(big.NewInt(15))
+
+	want := []TxLifecycleEvent{
+		{Hash: tx1.Hash(), Kind: TxAdded},
+		{Hash: tx0.Hash(), Kind: TxAdded},
+		{Hash: tx0.Hash(), Kind: TxPromoted},
+		{Hash: tx1.Hash(), Kind: TxPromoted},
+		{Hash: tx1.Hash(), Kind: TxDropped, Reason: TxDropReplaced},
+		{Hash: rep.Hash(), Kind: TxReplaced, Replaced: tx1.Hash()},
+		{Hash: rep.Hash(), Kind: TxDropped, Reason: TxDropUnderpriced},
+	}
+	for i, want := range want {
+		select {
+		case have := <-events:
+			if have != want {
+				t.Errorf("event %d: mismatch: have %+v, want %+v", i, have, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d: timeout waiting for %+v", i, want)
+		}
+	}
+	// Ensure the drop reasons are remembered, but only for dropped transactions
+	if drop := pool.DropReason(tx1.Hash()); drop == nil || drop.Reason != TxDropReplaced {
+		t.Errorf("replaced transaction drop reason mismatch: have %+v, want %v", drop, TxDropReplaced)
+	}
+	if drop := pool.DropReason(rep.Hash()); drop == nil || drop.Reason != TxDropUnderpriced {
+		t.Errorf("underpriced transaction drop reason mismatch: have %+v, want %v", drop, TxDropUnderpriced)
+	}
+	if drop := pool.DropReason(tx0.Hash()); drop != nil {
+		t.Errorf("pooled transaction has drop reason: %+v", drop)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// testBlockStore is a test blockchain serving a set of known blocks.
+type testBlockStore struct {
+	*testBlockChain
+	blocks map[common.Hash]*types.Block
+}
+
+func (bc *testBlockStore) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return bc.blocks[hash]
+}
+
+// Tests that transactions leaving the pool due to their nonce are reported as
+// included if mined, as reorged if invalidated by a reorg, and as stale if their
+// nonce was taken by another transaction of the sender.
+func TestTransactionDropReasonsOnReset(t *testing.T) {
+	t.Parallel()
+
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	blockchain := &testBlockStore{&testBlockChain{statedb, 1000000, new(event.Feed)}, make(map[common.Hash]*types.Block)}
+
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+		keys = append(keys, key)
+	}
+	var (
+		mined     = pricedTransaction(0, 100000, big.NewInt(1), keys[0])
+		stale     = pricedTransaction(0, 100000, big.NewInt(1), keys[1])
+		rival     = pricedTransaction(0, 100000, big.NewInt(2), keys[1])
+		reorged   = pricedTransaction(0, 100000, big.NewInt(1), keys[2])
+		genesis   = types.NewBlock(&types.Header{Number: big.NewInt(0), GasLimit: 1000000}, nil, nil, nil)
+		block     = types.NewBlock(&types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash(), GasLimit: 1000000}, types.Transactions{mined, rival}, nil, nil)
+		sidechain = types.NewBlock(&types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash(), GasLimit: 1000000, Extra: []byte("side")}, types.Transactions{mined, rival}, nil, nil)
+	)
+	for _, b := range []*types.Block{genesis, block, sidechain} {
+		blockchain.blocks[b.Hash()] = b
+	}
+	if errs := pool.AddRemotes([]*types.Transaction{mined, stale}); errs[0] != nil || errs[1] != nil {
+		t.Fatalf("failed to add transactions: %v", errs)
+	}
+	// Mine one of the transactions and a rival of the other on top of the genesis
+	statedb.SetNonce(crypto.PubkeyToAddress(keys[0].PublicKey), 1)
+	statedb.SetNonce(crypto.PubkeyToAddress(keys[1].PublicKey), 1)
+	pool.lockedReset(genesis.Header(), block.Header())
+
+	if drop := pool.DropReason(mined.Hash()); drop == nil || drop.Reason != TxDropIncluded {
+		t.Errorf("mined transaction drop reason mismatch: have %+v, want %v", drop, TxDropIncluded)
+	}
+	if drop := pool.DropReason(stale.Hash()); drop == nil || drop.Reason != TxDropStale {
+		t.Errorf("stale transaction drop reason mismatch: have %+v, want %v", drop, TxDropStale)
+	}
+	// Reorg to a sibling block invalidating the nonce of another transaction
+	if err := pool.AddRemote(reorged); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	statedb.SetNonce(crypto.PubkeyToAddress(keys[2].PublicKey), 1)
+	pool.lockedReset(block.Header(), sidechain.Header())
+
+	if drop := pool.DropReason(reorged.Hash()); drop == nil || drop.Reason != TxDropReorged {
+		t.Errorf("reorged transaction drop reason mismatch: have %+v, want %v", drop, TxDropReorged)
+	}
+	if pending, queued := pool.Stats(); pending != 0 || queued != 0 {
+		t.Errorf("pool not emptied: pending %d, queued %d", pending, queued)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that a lifecycle subscriber not consuming its events neither stalls the
+// pool nor makes the undelivered events pile up without bounds.
+func TestTransactionLifecycleSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	sub := pool.SubscribeTxLifecycleEvent(make(chan TxLifecycleEvent))
+	defer sub.Unsubscribe()
+
+	for i := 0; i < 2*txEventQueueLimit; i++ {
+		pool.mu.Lock()
+		pool.emit(TxLifecycleEvent{Hash: common.Hash{byte(i)}, Kind: TxAdded})
+		pool.mu.Unlock()
+	}
+	pool.eventsMu.Lock()
+	queued := len(pool.events)
+	pool.eventsMu.Unlock()
+	if queued > txEventQueueLimit {
+		t.Errorf("undelivered events not capped: have %d, want at most %d", queued, txEventQueueLimit)
+	}
+	// Ensure the pool still reacts to new chain heads and can be stopped
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(1), key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	pool.chainHeadCh <- ChainHeadEvent{Block: pool.chain.CurrentBlock()}
+
+	done := make(chan struct{})
+	go func() {
+		pool.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("pool stalled by slow lifecycle subscriber")
+	}
+}
+
+// Tests that removing a pending transaction demotes the ones depending on it
+// without pricing them a second time.
+func TestTransactionDemotionPricing(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	events := make(chan TxLifecycleEvent, 16)
+	sub := pool.SubscribeTxLifecycleEvent(events)
+	defer sub.Unsubscribe()
+
+	txs := []*types.Transaction{
+		pricedTransaction(0, 100000, big.NewInt(20), key),
+		pricedTransaction(1, 100000, big.NewInt(10), key),
+		pricedTransaction(2, 100000, big.NewInt(20), key),
+	}
+	for _, err := range pool.AddRemotes(txs) {
+		if err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+	// Drop the cheap middle transaction, demoting the one after it
+	pool.SetGasPrice(big.NewInt(15))
+
+	if pending, queued := pool.Stats(); pending != 1 || queued != 1 {
+		t.Fatalf("pool size mismatch: have %d pending %d queued, want 1 pending 1 queued", pending, queued)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	for {
+		select {
+		case ev := <-events:
+			if ev.Kind == TxDemoted {
+				if ev.Hash != txs[2].Hash() {
+					t.Errorf("demoted transaction mismatch: have %x, want %x", ev.Hash, txs[2].Hash())
+				}
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for demotion event")
+		}
+	}
+}
+
+// Tests that removing the last pending transaction of an account still moves
+// the ones depending on it back to the future queue instead of losing them.
+func TestTransactionDemotionEmptyPending(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	txs := []*types.Transaction{
+		pricedTransaction(0, 100000, big.NewInt(10), key),
+		pricedTransaction(1, 100000, big.NewInt(20), key),
+	}
+	for _, err := range pool.AddRemotes(txs) {
+		if err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+	// Drop the cheap first transaction, invalidating the whole pending list
+	pool.SetGasPrice(big.NewInt(15))
+
+	if pending, queued := pool.Stats(); pending != 0 || queued != 1 {
+		t.Fatalf("pool size mismatch: have %d pending %d queued, want 0 pending 1 queued", pending, queued)
+	}
+	if status := pool.Status([]common.Hash{txs[1].Hash()})[0]; status != TxStatusQueued {
+		t.Errorf("demoted transaction status mismatch: have %v, want %v", status, TxStatusQueued)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the drop history forgets the oldest drops when full.
+func TestTransactionDropHistory(t *testing.T) {
+	history := newTxDropHistory(2)
+
+	history.add(common.Hash{1}, TxDropStale)
+	history.add(common.Hash{2}, TxDropEvicted)
+	history.add(common.Hash{1}, TxDropExpired)
+	history.add(common.Hash{3}, TxDropUnpayable)
+
+	if drop := history.get(common.Hash{1}); drop != nil {
+		t.Errorf("oldest drop not forgotten: %+v", drop)
+	}
+	if drop := history.get(common.Hash{2}); drop == nil || drop.Reason != TxDropEvicted {
+		t.Errorf("drop reason mismatch: have %+v, want %v", drop, TxDropEvicted)
+	}
+	if drop := history.get(common.Hash{3}); drop == nil || drop.Reason != TxDropUnpayable {
+		t.Errorf("drop reason mismatch: have %+v, want %v", drop, TxDropUnpayable)
+	}
+	if len(history.order) != 2 || len(history.drops) != 2 {
+		t.Errorf("history size mismatch: have %d/%d, want 2", len(history.order), len(history.drops))
+	}
+}
+
+// Tests that the pool tracks the arrival time of the known transactions and
+// forgets it when they are dropped.
+func TestTransactionArrivalTime(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+
+	before := time.Now()
+	tx := pricedTransaction(0, 100000, big.NewInt(1), key)
+	if err := pool.AddRemote(tx); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if arrived := pool.ArrivalTime(tx.Hash()); arrived.Before(before) || arrived.After(time.Now()) {
+		t.Errorf("arrival time mismatch: have %v, want after %v", arrived, before)
+	}
+	// Replace the transaction and ensure the old arrival is forgotten
+	replacement := pricedTransaction(0, 100000, big.NewInt(2), key)
+	if err := pool.AddRemote(replacement); err != nil {
+		t.Fatalf("failed to replace transaction: %v", err)
+	}
+	if arrived := pool.ArrivalTime(tx.Hash()); !arrived.IsZero() {
+		t.Errorf("replaced transaction arrival not forgotten: %v", arrived)
+	}
+	if arrived := pool.ArrivalTime(replacement.Hash()); arrived.IsZero() {
+		t.Errorf("replacement transaction arrival missing")
+	}
+}
+
 // TestTransactionStatusCheck tests that the pool can correctly retrieve the
 // pending status of individual transactions.
 func TestTransactionStatusCheck(t *testing.T) {
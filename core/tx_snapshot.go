@@ -0,0 +1,97 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// txSnapshotAccount is the pool content of a single account in a snapshot.
+type txSnapshotAccount struct {
+	Address common.Address       // Account the transactions originate from
+	Local   bool                 // Whether the account is tracked as a local one
+	Beat    uint64               // Last heartbeat of the account in unix nanoseconds
+	Pending []*types.Transaction // Processable transactions, sorted by nonce
+	Queued  []*types.Transaction // Non-processable transactions, sorted by nonce
+}
+
+// txSnapshot is a full dump of the transaction pool, local and remote, pending
+// and queued, with the aim of allowing the whole pool to survive node restarts.
+// Contrary to the journal, it is regenerated from scratch on every save.
+type txSnapshot struct {
+	path string // Filesystem path to store the snapshot at
+}
+
+// newTxSnapshot creates a new transaction pool snapshot stored at the given path.
+func newTxSnapshot(path string) *txSnapshot {
+	return &txSnapshot{
+		path: path,
+	}
+}
+
+// load parses a transaction pool snapshot from disk.
+func (snapshot *txSnapshot) load() ([]*txSnapshotAccount, error) {
+	// Skip the parsing if the snapshot file doesn't exist at all
+	if _, err := os.Stat(snapshot.path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	input, err := os.Open(snapshot.path)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	var accounts []*txSnapshotAccount
+	if err := rlp.Decode(input, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// save replaces the snapshot on disk with the given pool contents.
+func (snapshot *txSnapshot) save(accounts []*txSnapshotAccount) error {
+	start := time.Now()
+
+	// Write the new snapshot aside, so a crash doesn't lose the previous one
+	output, err := os.OpenFile(snapshot.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if err = rlp.Encode(output, accounts); err != nil {
+		output.Close()
+		return err
+	}
+	if err = output.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(snapshot.path+".new", snapshot.path); err != nil {
+		return err
+	}
+	txs := 0
+	for _, account := range accounts {
+		txs += len(account.Pending) + len(account.Queued)
+	}
+	log.Info("Stored transaction pool snapshot", "transactions", txs, "accounts", len(accounts), "elapsed", common.PrettyDuration(time.Since(start)))
+
+	return nil
+}
@@ -16,7 +16,17 @@
 
 package vm
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
 
 func TestMemoryGasCost(t *testing.T) {
 	//size := uint64(math.MaxUint64 - 64)
@@ -34,3 +44,63 @@ func TestMemoryGasCost(t *testing.T) {
 		t.Error("expected error")
 	}
 }
+
+var eip1283Tests = []struct {
+	original byte
+	code     string
+	used     uint64
+	refund   uint64
+}{
+	{0, "0x60006000556000600055", 412, 0},
+	{0, "0x60006000556001600055", 20212, 0},
+	{0, "0x60016000556000600055", 20212, 19800},
+	{0, "0x60016000556002600055", 20212, 0},
+	{0, "0x60016000556001600055", 20212, 0},
+	{1, "0x60006000556000600055", 5212, 15000},
+	{1, "0x60006000556001600055", 5212, 4800},
+	{1, "0x60006000556002600055", 5212, 0},
+	{1, "0x60026000556000600055", 5212, 15000},
+	{1, "0x60026000556003600055", 5212, 0},
+	{1, "0x60026000556001600055", 5212, 4800},
+	{1, "0x60026000556002600055", 5212, 0},
+	{1, "0x60016000556000600055", 5212, 15000},
+	{1, "0x60016000556002600055", 5212, 0},
+	{1, "0x60016000556001600055", 412, 0},
+	{0, "0x600160005560006000556001600055", 40218, 19800},
+	{1, "0x600060005560016000556000600055", 10218, 19800},
+}
+
+// Tests the net gas metering of SSTORE against the test vectors of EIP-1283.
+func TestEIP1283(t *testing.T) {
+	config := *params.AllEthashProtocolChanges
+	config.ConstantinopleBlock = big.NewInt(0)
+
+	address := common.BytesToAddress([]byte("contract"))
+	for i, tt := range eip1283Tests {
+		db, _ := ethdb.NewMemDatabase()
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+		statedb.CreateAccount(address)
+		statedb.SetCode(address, hexutil.MustDecode(tt.code))
+		statedb.SetState(address, common.Hash{}, common.BytesToHash([]byte{tt.original}))
+		statedb.Finalise(true) // Push the state into the "original" slot
+
+		vmctx := Context{
+			CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+			Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+			BlockNumber: new(big.Int),
+		}
+		vmenv := NewEVM(vmctx, statedb, &config, Config{})
+
+		_, gas, err := vmenv.Call(AccountRef(common.Address{}), address, nil, math.MaxUint64, new(big.Int))
+		if err != nil {
+			t.Errorf("test %d: failed to execute transaction: %v", i, err)
+			continue
+		}
+		if used := math.MaxUint64 - gas; used != tt.used {
+			t.Errorf("test %d: gas used mismatch: have %v, want %v", i, used, tt.used)
+		}
+		if refund := vmenv.StateDB.GetRefund(); refund != tt.refund {
+			t.Errorf("test %d: gas refund mismatch: have %v, want %v", i, refund, tt.refund)
+		}
+	}
+}
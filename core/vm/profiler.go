@@ -0,0 +1,260 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// GasStat is the aggregated execution count and gas usage of some code.
+type GasStat struct {
+	Count uint64 `json:"count"`
+	Gas   uint64 `json:"gas"`
+}
+
+func (s *GasStat) add(gas uint64) {
+	s.Count++
+	s.Gas += gas
+}
+
+// PCProfile is the gas profile of a single instruction of a contract.
+type PCProfile struct {
+	GasStat
+	Op     string `json:"op"`
+	Source string `json:"source,omitempty"` // File and line of the instruction, if known
+}
+
+// ContractProfile is the gas profile of the code of a single contract.
+type ContractProfile struct {
+	GasStat
+	Calls uint64                `json:"calls"`           // Number of times the code was entered
+	PCs   map[uint64]*PCProfile `json:"pcs"`             // Profile per program counter
+	Lines map[string]*GasStat   `json:"lines,omitempty"` // Profile per source line, if a source map is known
+}
+
+// GasProfile is the result of a GasProfiler, containing the gas spent on
+// executing each opcode, contract and instruction. Gas is attributed to the
+// instruction that spent it, so calls and contract creations are only charged
+// for their own overhead (including the code deposit of created contracts),
+// not for the gas used by the code they execute.
+type GasProfile struct {
+	Opcodes   map[string]*GasStat                 `json:"opcodes"`
+	Contracts map[common.Address]*ContractProfile `json:"contracts"`
+	Overhead  uint64                              `json:"overhead"` // Gas used outside of any instruction, e.g. the code deposit of a contract creation
+}
+
+// profileFrame is the state of a single call frame being profiled.
+type profileFrame struct {
+	profile *ContractProfile // Profile of the executed code
+	srcmap  *SourceMap       // Source map of the executed code, if known
+	indices map[uint64]int   // Instruction indices of the executed code, if it has a source map
+
+	pending  bool   // Whether an instruction is awaiting its gas to be settled
+	pc       uint64 // Program counter of the pending instruction
+	op       OpCode // Opcode of the pending instruction
+	gas      uint64 // Gas available before the pending instruction
+	cost     uint64 // Gas cost reported for the pending instruction
+	children uint64 // Gas used by the frames entered by the pending instruction
+
+	used uint64 // Gas used by the frame so far, including its children
+}
+
+// GasProfiler is an EVM tracer which aggregates the gas spent on executing
+// code per opcode, per contract and per program counter. Contracts are keyed
+// by the address of their code, which differs from the executing account in
+// case of DELEGATECALL and CALLCODE.
+//
+// The gas of an instruction is settled when its frame continues, which makes
+// it possible to separate the gas of calls from the gas forwarded to them.
+type GasProfiler struct {
+	srcmaps map[common.Address]*SourceMap
+	profile *GasProfile
+	frames  []*profileFrame
+}
+
+// NewGasProfiler returns a new gas profiler, resolving the instructions of the
+// contracts with a known source map to source lines.
+func NewGasProfiler(srcmaps map[common.Address]*SourceMap) *GasProfiler {
+	return &GasProfiler{
+		srcmaps: srcmaps,
+		profile: &GasProfile{
+			Opcodes:   make(map[string]*GasStat),
+			Contracts: make(map[common.Address]*ContractProfile),
+		},
+	}
+}
+
+// CaptureStart implements the Tracer interface, it is a noop for the profiler.
+func (p *GasProfiler) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureState implements the Tracer interface, settling the gas of the
+// previous instruction of the frame and recording the current one.
+func (p *GasProfiler) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	p.unwind(depth)
+
+	// Settle the previous instruction, or enter a new frame
+	if len(p.frames) == depth {
+		frame := p.frames[depth-1]
+		if frame.pending {
+			p.settle(frame, frame.gas-gas)
+		}
+	} else {
+		p.enter(contract)
+	}
+	frame := p.frames[len(p.frames)-1]
+
+	// Instructions failing before execution consume all the remaining gas
+	if err != nil {
+		frame.pending, frame.pc, frame.op, frame.children = false, pc, op, 0
+		p.record(frame, gas)
+		frame.used += gas
+		return nil
+	}
+	frame.pending, frame.pc, frame.op, frame.gas, frame.cost, frame.children = true, pc, op, gas, cost, 0
+	return nil
+}
+
+// CaptureFault implements the Tracer interface, settling the instruction that
+// failed during execution. Apart from REVERT, failing instructions consume all
+// the remaining gas of the frame.
+func (p *GasProfiler) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	p.unwind(depth)
+	if len(p.frames) != depth || !p.frames[depth-1].pending {
+		return nil
+	}
+	frame := p.frames[depth-1]
+	if op == REVERT {
+		p.settle(frame, cost)
+	} else {
+		p.settle(frame, gas)
+	}
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface, settling all the frames that
+// are still open and recording the gas not spent by any instruction.
+func (p *GasProfiler) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	var used uint64
+	if len(p.frames) > 0 {
+		root := p.frames[0]
+		p.unwind(0)
+		used = root.used
+	}
+	if gasUsed > used {
+		p.profile.Overhead += gasUsed - used
+	}
+	return nil
+}
+
+// Profile returns the gas profile gathered so far.
+func (p *GasProfiler) Profile() *GasProfile {
+	return p.profile
+}
+
+// enter opens a new frame executing the code of the given contract.
+func (p *GasProfiler) enter(contract *Contract) {
+	code := contract.Address()
+	if contract.CodeAddr != nil {
+		code = *contract.CodeAddr
+	}
+	profile, ok := p.profile.Contracts[code]
+	if !ok {
+		profile = &ContractProfile{PCs: make(map[uint64]*PCProfile)}
+		p.profile.Contracts[code] = profile
+	}
+	profile.Calls++
+
+	frame := &profileFrame{profile: profile}
+	if srcmap, ok := p.srcmaps[code]; ok {
+		if profile.Lines == nil {
+			profile.Lines = make(map[string]*GasStat)
+		}
+		frame.srcmap, frame.indices = srcmap, instructionIndices(contract.Code)
+	}
+	p.frames = append(p.frames, frame)
+}
+
+// unwind closes all the frames deeper than the given depth. The last
+// instruction of a returning frame is charged its reported cost, and the gas
+// used by the frame is credited to the instruction which entered it.
+func (p *GasProfiler) unwind(depth int) {
+	for len(p.frames) > depth {
+		frame := p.frames[len(p.frames)-1]
+		if frame.pending {
+			p.settle(frame, frame.cost)
+		}
+		p.frames = p.frames[:len(p.frames)-1]
+
+		if len(p.frames) > 0 {
+			p.frames[len(p.frames)-1].children += frame.used
+		}
+	}
+}
+
+// settle charges the pending instruction of a frame with the gas used by it,
+// minus the gas used by the frames it entered.
+func (p *GasProfiler) settle(frame *profileFrame, used uint64) {
+	frame.pending = false
+
+	self := uint64(0)
+	if used > frame.children {
+		self = used - frame.children
+	}
+	p.record(frame, self)
+	frame.used += self + frame.children
+}
+
+// record adds the gas spent on the current instruction of the frame to the
+// profile.
+func (p *GasProfiler) record(frame *profileFrame, gas uint64) {
+	opcode, ok := p.profile.Opcodes[frame.op.String()]
+	if !ok {
+		opcode = new(GasStat)
+		p.profile.Opcodes[frame.op.String()] = opcode
+	}
+	opcode.add(gas)
+	frame.profile.add(gas)
+
+	instr, ok := frame.profile.PCs[frame.pc]
+	if !ok {
+		instr = &PCProfile{Op: frame.op.String()}
+		if frame.srcmap != nil {
+			if index, ok := frame.indices[frame.pc]; ok {
+				if file, line, ok := frame.srcmap.Position(index); ok {
+					instr.Source = fmt.Sprintf("%s:%d", file, line)
+				}
+			}
+		}
+		frame.profile.PCs[frame.pc] = instr
+	}
+	instr.add(gas)
+
+	if instr.Source != "" {
+		stat, ok := frame.profile.Lines[instr.Source]
+		if !ok {
+			stat = new(GasStat)
+			frame.profile.Lines[instr.Source] = stat
+		}
+		stat.add(gas)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestSourceMap(t *testing.T) {
+	files := []SourceFile{{Name: "a.sol", Content: "first\nsecond\nthird\n"}}
+
+	srcmap, err := NewSourceMap("0:5:0:-;6:6;;13:5::i;:;1:1:-1", files)
+	if err != nil {
+		t.Fatalf("failed to parse source map: %v", err)
+	}
+	tests := []struct {
+		index int
+		line  int
+		ok    bool
+	}{{0, 1, true}, {1, 2, true}, {2, 2, true}, {3, 3, true}, {4, 3, true}, {5, 0, false}, {6, 0, false}}
+	for _, tt := range tests {
+		file, line, ok := srcmap.Position(tt.index)
+		if ok != tt.ok || line != tt.line || (ok && file != "a.sol") {
+			t.Errorf("instruction %d: position mismatch: have %s:%d (%v), want a.sol:%d (%v)", tt.index, file, line, ok, tt.line, tt.ok)
+		}
+	}
+	if _, err := NewSourceMap("0:5:1", files); err == nil {
+		t.Errorf("expected error for unknown source file")
+	}
+	if _, err := NewSourceMap("0:x:0", files); err == nil {
+		t.Errorf("expected error for malformed entry")
+	}
+}
+
+func TestGasProfiler(t *testing.T) {
+	var (
+		caller = common.BytesToAddress([]byte{0xaa})
+		callee = common.BytesToAddress([]byte{0xbb})
+	)
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	// The caller calls the callee with all its gas, which stores 1 in slot 0
+	statedb.SetCode(caller, []byte{
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0,
+		byte(PUSH1), 0xbb, byte(GAS), byte(CALL), byte(STOP),
+	})
+	statedb.SetCode(callee, []byte{byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE), byte(STOP)})
+
+	srcmap, err := NewSourceMap("0:1:0;2:1;4:1;-1:-1:-1", []SourceFile{{Name: "b.sol", Content: "a\nb\nc"}})
+	if err != nil {
+		t.Fatalf("failed to parse source map: %v", err)
+	}
+	profiler := NewGasProfiler(map[common.Address]*SourceMap{callee: srcmap})
+
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: big.NewInt(0),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.TestChainConfig, Config{Debug: true, Tracer: profiler})
+
+	_, leftover, err := vmenv.Call(AccountRef(common.Address{}), caller, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatalf("failed to execute caller: %v", err)
+	}
+	profile := profiler.Profile()
+	callGas := params.GasTableEIP158.Calls
+
+	// The call must only be charged its own overhead, with all gas accounted for
+	if have := profile.Opcodes["CALL"]; have.Count != 1 || have.Gas != callGas {
+		t.Errorf("CALL profile mismatch: have %+v, want {Count:1 Gas:%d}", *have, callGas)
+	}
+	if have := profile.Opcodes["SSTORE"]; have.Count != 1 || have.Gas != params.SstoreSetGas {
+		t.Errorf("SSTORE profile mismatch: have %+v, want {Count:1 Gas:%d}", *have, params.SstoreSetGas)
+	}
+	var total uint64
+	for _, stat := range profile.Opcodes {
+		total += stat.Gas
+	}
+	if total != 100000-leftover {
+		t.Errorf("total gas mismatch: have %d, want %d", total, 100000-leftover)
+	}
+	if have, want := profile.Contracts[caller].Gas, uint64(6*GasFastestStep+GasQuickStep+callGas); have != want {
+		t.Errorf("caller gas mismatch: have %d, want %d", have, want)
+	}
+	if have := profile.Contracts[callee]; have.Calls != 1 || have.Count != 4 || have.Gas != 2*GasFastestStep+params.SstoreSetGas {
+		t.Errorf("callee profile mismatch: have %+v", *have)
+	}
+	// The callee's instructions must be resolved to source lines
+	if have := profile.Contracts[callee].PCs[4]; have.Op != "SSTORE" || have.Source != "b.sol:3" {
+		t.Errorf("SSTORE instruction mismatch: have %+v", *have)
+	}
+	if have := profile.Contracts[callee].PCs[5].Source; have != "" {
+		t.Errorf("STOP instruction source mismatch: have %q, want none", have)
+	}
+	if have := profile.Contracts[callee].Lines["b.sol:3"]; have == nil || have.Gas != params.SstoreSetGas {
+		t.Errorf("source line profile mismatch: have %+v", have)
+	}
+	if len(profile.Contracts[caller].Lines) != 0 {
+		t.Errorf("caller without source map has source lines: %v", profile.Contracts[caller].Lines)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 func TestDefaults(t *testing.T) {
@@ -117,6 +118,46 @@ func TestCall(t *testing.T) {
 	}
 }
 
+// Tests that the Istanbul CHAINID and SELFBALANCE opcodes return the chain id
+// of the configuration and the balance of the executing contract.
+func TestIstanbulOpcodes(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	address := common.HexToAddress("0x0a")
+	state.SetBalance(address, big.NewInt(42))
+	state.SetCode(address, []byte{
+		byte(vm.CHAINID),
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.SELFBALANCE),
+		byte(vm.PUSH1), 32,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 64,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	})
+	config := &params.ChainConfig{
+		ChainId:             big.NewInt(1337),
+		HomesteadBlock:      new(big.Int),
+		EIP150Block:         new(big.Int),
+		EIP155Block:         new(big.Int),
+		EIP158Block:         new(big.Int),
+		ByzantiumBlock:      new(big.Int),
+		ConstantinopleBlock: new(big.Int),
+		IstanbulBlock:       new(big.Int),
+	}
+	ret, _, err := Call(address, nil, &Config{State: state, ChainConfig: config, BlockNumber: new(big.Int)})
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	if chainId := new(big.Int).SetBytes(ret[:32]); chainId.Cmp(big.NewInt(1337)) != 0 {
+		t.Error("Expected chain id 1337, got", chainId)
+	}
+	if balance := new(big.Int).SetBytes(ret[32:]); balance.Cmp(big.NewInt(42)) != 0 {
+		t.Error("Expected balance 42, got", balance)
+	}
+}
+
 func BenchmarkCall(b *testing.B) {
 	var definition = `[{"constant":true,"inputs":[],"name":"seller","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"abort","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"value","outputs":[{"name":"","type":"uint256"}],"type":"function"},{"constant":false,"inputs":[],"name":"refund","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"buyer","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmReceived","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"state","outputs":[{"name":"","type":"uint8"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmPurchase","outputs":[],"type":"function"},{"inputs":[],"type":"constructor"},{"anonymous":false,"inputs":[],"name":"Aborted","type":"event"},{"anonymous":false,"inputs":[],"name":"PurchaseConfirmed","type":"event"},{"anonymous":false,"inputs":[],"name":"ItemReceived","type":"event"},{"anonymous":false,"inputs":[],"name":"Refunded","type":"event"}]`
 
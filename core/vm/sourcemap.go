@@ -0,0 +1,122 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SourceFile is a source unit referenced by a solc source map.
+type SourceFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// sourceMapEntry is the decoded source range of a single instruction.
+type sourceMapEntry struct {
+	start  int // Byte offset of the range in the source file
+	length int // Length of the range in bytes
+	file   int // Index of the source file, -1 if the instruction has no source
+}
+
+// SourceMap maps the instructions of a contract's code to locations in its
+// Solidity sources, as described by a compressed solc source map.
+type SourceMap struct {
+	entries []sourceMapEntry
+	files   []SourceFile
+	lines   [][]int // Byte offsets of the line starts of each source file
+}
+
+// NewSourceMap parses a compressed solc source map (semicolon separated
+// s:l:f:j entries, where omitted fields repeat the previous entry) for the
+// given source files, indexed by their solc source id.
+func NewSourceMap(mapping string, files []SourceFile) (*SourceMap, error) {
+	m := &SourceMap{files: files}
+	for _, file := range files {
+		starts := []int{0}
+		for i, c := range file.Content {
+			if c == '\n' {
+				starts = append(starts, i+1)
+			}
+		}
+		m.lines = append(m.lines, starts)
+	}
+	if mapping == "" {
+		return m, nil
+	}
+	prev := sourceMapEntry{file: -1}
+	for i, item := range strings.Split(mapping, ";") {
+		entry := prev
+		for j, field := range strings.Split(item, ":") {
+			if field == "" || j > 2 {
+				continue // inherited, or jump type and modifier depth
+			}
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid source map entry %d: %v", i, err)
+			}
+			switch j {
+			case 0:
+				entry.start = n
+			case 1:
+				entry.length = n
+			case 2:
+				entry.file = n
+			}
+		}
+		if entry.file >= len(files) {
+			return nil, fmt.Errorf("invalid source map entry %d: unknown source %d", i, entry.file)
+		}
+		m.entries = append(m.entries, entry)
+		prev = entry
+	}
+	return m, nil
+}
+
+// Position returns the source file name and line number (starting at one) of
+// the instruction with the given index, or false if it has no source.
+func (m *SourceMap) Position(index int) (string, int, bool) {
+	if index < 0 || index >= len(m.entries) {
+		return "", 0, false
+	}
+	entry := m.entries[index]
+	if entry.file < 0 {
+		return "", 0, false
+	}
+	starts := m.lines[entry.file]
+	line := sort.Search(len(starts), func(i int) bool { return starts[i] > entry.start })
+	return m.files[entry.file].Name, line, true
+}
+
+// instructionIndices maps the program counter of every instruction in code to
+// its index, which is how source maps refer to instructions.
+func instructionIndices(code []byte) map[uint64]int {
+	indices := make(map[uint64]int)
+	for pc, index := uint64(0), 0; pc < uint64(len(code)); index++ {
+		indices[pc] = index
+
+		op := OpCode(code[pc])
+		if op.IsPush() {
+			pc += uint64(op - PUSH1 + 1)
+		}
+		pc++
+	}
+	return indices
+}
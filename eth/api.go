@@ -30,6 +30,7 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/params"
@@ -187,6 +188,15 @@ func (api *PrivateMinerAPI) SetGasPrice(gasPrice hexutil.Big) bool {
 	return true
 }
 
+// SetGasLimit steers the gas limit of the mined blocks towards the given floor
+// and ceiling. A zero ceiling leaves the gas limit uncapped upwards.
+func (api *PrivateMinerAPI) SetGasLimit(gasFloor, gasCeil hexutil.Uint64) (bool, error) {
+	if err := api.e.Miner().SetGasLimit(uint64(gasFloor), uint64(gasCeil)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // SetEtherbase sets the etherbase of the miner
 func (api *PrivateMinerAPI) SetEtherbase(etherbase common.Address) bool {
 	api.e.SetEtherbase(etherbase)
@@ -198,6 +208,132 @@ func (api *PrivateMinerAPI) GetHashrate() uint64 {
 	return uint64(api.e.miner.HashRate())
 }
 
+// PublicTxLifecycleAPI provides an API to follow what happens to transactions
+// within the transaction pool, including why they were dropped from it.
+type PublicTxLifecycleAPI struct {
+	e *Ethereum
+}
+
+// NewPublicTxLifecycleAPI creates a new transaction pool lifecycle API.
+func NewPublicTxLifecycleAPI(e *Ethereum) *PublicTxLifecycleAPI {
+	return &PublicTxLifecycleAPI{e: e}
+}
+
+// TxLifecycleStatus is the status of a transaction as seen by the pool, along
+// with the reason and unix time of its removal if it was dropped recently.
+type TxLifecycleStatus struct {
+	Status string            `json:"status"`
+	Reason core.TxDropReason `json:"reason,omitempty"`
+	Time   uint64            `json:"time,omitempty"`
+}
+
+// TransactionStatus returns whether the given transaction is pending or queued
+// in the pool, or was recently dropped from it and why.
+func (api *PublicTxLifecycleAPI) TransactionStatus(hash common.Hash) *TxLifecycleStatus {
+	switch api.e.txPool.Status([]common.Hash{hash})[0] {
+	case core.TxStatusPending:
+		return &TxLifecycleStatus{Status: "pending"}
+	case core.TxStatusQueued:
+		return &TxLifecycleStatus{Status: "queued"}
+	}
+	if drop := api.e.txPool.DropReason(hash); drop != nil {
+		return &TxLifecycleStatus{Status: "dropped", Reason: drop.Reason, Time: uint64(drop.Time.Unix())}
+	}
+	return &TxLifecycleStatus{Status: "unknown"}
+}
+
+// txLifecycleEvent is the notification sent to lifecycle event subscribers.
+type txLifecycleEvent struct {
+	Hash     common.Hash       `json:"hash"`
+	Kind     core.TxLifecycle  `json:"kind"`
+	Replaced *common.Hash      `json:"replaced,omitempty"`
+	Reason   core.TxDropReason `json:"reason,omitempty"`
+}
+
+// Lifecycle creates a subscription that is triggered each time a transaction is
+// added to, promoted, demoted, replaced within or dropped from the pool.
+func (api *PublicTxLifecycleAPI) Lifecycle(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan core.TxLifecycleEvent, 256)
+		sub := api.e.txPool.SubscribeTxLifecycleEvent(events)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				notification := &txLifecycleEvent{Hash: ev.Hash, Kind: ev.Kind, Reason: ev.Reason}
+				if ev.Kind == core.TxReplaced {
+					notification.Replaced = &ev.Replaced
+				}
+				notifier.Notify(rpcSub.ID, notification)
+			case <-sub.Err():
+				return
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+// PrivateTxPoolAPI is the collection of transaction pool related APIs exposed
+// over the private admin endpoint.
+type PrivateTxPoolAPI struct {
+	e *Ethereum
+}
+
+// NewPrivateTxPoolAPI creates a new RPC service which controls the transaction
+// pool of this node.
+func NewPrivateTxPoolAPI(e *Ethereum) *PrivateTxPoolAPI {
+	return &PrivateTxPoolAPI{e: e}
+}
+
+// Policy returns the admission policy rules enforced by the transaction pool,
+// or nil if there are none.
+func (api *PrivateTxPoolAPI) Policy() *core.TxPolicyConfig {
+	if policy, ok := api.e.txPool.Policy().(*core.TxRulePolicy); ok {
+		config := policy.Config()
+		return &config
+	}
+	return nil
+}
+
+// PrivateTxPolicyAPI is the collection of RPC methods replacing the admission
+// policy of the transaction pool. They share the txpool namespace with the read
+// only APIs, so anyone allowed to access that namespace could lift the policy;
+// the service is therefore only registered if explicitly enabled in the config.
+type PrivateTxPolicyAPI struct {
+	e *Ethereum
+}
+
+// NewPrivateTxPolicyAPI creates a new RPC service which controls the admission
+// policy of the transaction pool of this node.
+func NewPrivateTxPolicyAPI(e *Ethereum) *PrivateTxPolicyAPI {
+	return &PrivateTxPolicyAPI{e: e}
+}
+
+// SetPolicy replaces the admission policy rules of the transaction pool. The
+// new rules only apply to transactions entering the pool from now on.
+func (api *PrivateTxPolicyAPI) SetPolicy(config core.TxPolicyConfig) bool {
+	api.e.txPool.SetPolicy(core.NewTxRulePolicy(config))
+	return true
+}
+
+// ClearPolicy removes the admission policy of the transaction pool, accepting
+// every valid transaction.
+func (api *PrivateTxPolicyAPI) ClearPolicy() bool {
+	api.e.txPool.SetPolicy(nil)
+	return true
+}
+
 // PrivateAdminAPI is the collection of Ethereum full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
@@ -402,6 +538,116 @@ func storageRangeAt(st state.Trie, start []byte, maxResult int) (StorageRangeRes
 	return result, nil
 }
 
+const (
+	// AccountRangeMaxResults is the maximum number of accounts returned by a
+	// single debug_accountRange call, regardless of the requested limit.
+	AccountRangeMaxResults = 256
+
+	// AccountRangeMaxStorage is the maximum number of storage slots returned
+	// per account by debug_accountRange. The rest can be retrieved with
+	// debug_storageRangeAt, starting at the account's storageNextKey.
+	AccountRangeMaxStorage = 256
+)
+
+// AccountRangeResult is the result of a debug_accountRange API call.
+type AccountRangeResult struct {
+	Accounts accountMap   `json:"accounts"`
+	NextKey  *common.Hash `json:"nextKey"` // nil if Accounts includes the last key in the trie.
+}
+
+type accountMap map[common.Hash]accountEntry
+
+type accountEntry struct {
+	Address  *common.Address `json:"address"`
+	Balance  *hexutil.Big    `json:"balance"`
+	Nonce    hexutil.Uint64  `json:"nonce"`
+	Root     common.Hash     `json:"root"`
+	CodeHash common.Hash     `json:"codeHash"`
+	Code     hexutil.Bytes   `json:"code,omitempty"`
+	Storage  storageMap      `json:"storage,omitempty"`
+
+	StorageNextKey *common.Hash `json:"storageNextKey,omitempty"` // nil if Storage includes the last slot
+}
+
+// AccountRange enumerates the accounts of the state at the given block, in the
+// order of their hashes, starting at the given hash prefix. At most
+// AccountRangeMaxResults accounts and AccountRangeMaxStorage storage slots per
+// account are returned.
+func (api *PrivateDebugAPI) AccountRange(ctx context.Context, blockNr rpc.BlockNumber, keyStart hexutil.Bytes, maxResult int, includeStorage, includeCode bool) (AccountRangeResult, error) {
+	var block *types.Block
+	switch blockNr {
+	case rpc.PendingBlockNumber:
+		return AccountRangeResult{}, fmt.Errorf("account range of pending state not supported")
+	case rpc.LatestBlockNumber:
+		block = api.eth.blockchain.CurrentBlock()
+	default:
+		block = api.eth.blockchain.GetBlockByNumber(uint64(blockNr))
+	}
+	if block == nil {
+		return AccountRangeResult{}, fmt.Errorf("block #%d not found", blockNr)
+	}
+	statedb, err := api.eth.BlockChain().StateAt(block.Root())
+	if err != nil {
+		return AccountRangeResult{}, err
+	}
+	return accountRangeAt(statedb.Database(), block.Root(), keyStart, maxResult, includeStorage, includeCode)
+}
+
+func accountRangeAt(db state.Database, root common.Hash, start []byte, maxResult int, includeStorage, includeCode bool) (AccountRangeResult, error) {
+	tr, err := db.OpenTrie(root)
+	if err != nil {
+		return AccountRangeResult{}, err
+	}
+	if maxResult > AccountRangeMaxResults {
+		maxResult = AccountRangeMaxResults
+	}
+	it := trie.NewIterator(tr.NodeIterator(start))
+	result := AccountRangeResult{Accounts: accountMap{}}
+	for i := 0; i < maxResult && it.Next(); i++ {
+		var data state.Account
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			return AccountRangeResult{}, err
+		}
+		hash := common.BytesToHash(it.Key)
+		e := accountEntry{
+			Balance:  (*hexutil.Big)(data.Balance),
+			Nonce:    hexutil.Uint64(data.Nonce),
+			Root:     data.Root,
+			CodeHash: common.BytesToHash(data.CodeHash),
+		}
+		if preimage := tr.GetKey(it.Key); preimage != nil {
+			addr := common.BytesToAddress(preimage)
+			e.Address = &addr
+		}
+		if includeCode && e.CodeHash != crypto.Keccak256Hash(nil) {
+			if e.Code, err = db.ContractCode(hash, e.CodeHash); err != nil {
+				return AccountRangeResult{}, err
+			}
+		}
+		if includeStorage {
+			st, err := db.OpenStorageTrie(hash, data.Root)
+			if err != nil {
+				return AccountRangeResult{}, err
+			}
+			storage, err := storageRangeAt(st, nil, AccountRangeMaxStorage)
+			if err != nil {
+				return AccountRangeResult{}, err
+			}
+			e.Storage, e.StorageNextKey = storage.Storage, storage.NextKey
+		}
+		result.Accounts[hash] = e
+	}
+	// Add the 'next key' so clients can continue downloading.
+	if it.Next() {
+		next := common.BytesToHash(it.Key)
+		result.NextKey = &next
+	}
+	if it.Err != nil {
+		return AccountRangeResult{}, it.Err
+	}
+	return result, nil
+}
+
 // GetModifiedAccountsByumber returns all accounts that have changed between the
 // two blocks specified. A change is defined as a difference in nonce, balance,
 // code hash, or storage hash.
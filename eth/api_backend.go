@@ -93,6 +93,12 @@ func (b *EthApiBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.
 		return nil, nil, err
 	}
 	stateDb, err := b.eth.BlockChain().StateAt(header.Root)
+	if err != nil {
+		// Pruned state might still be reconstructed from the reverse diffs
+		if historic, herr := b.eth.BlockChain().HistoricState(header); herr == nil {
+			return historic, header, nil
+		}
+	}
 	return stateDb, header, err
 }
 
@@ -112,6 +118,9 @@ func (b *EthApiBackend) GetEVM(ctx context.Context, msg core.Message, state *sta
 	state.SetBalance(msg.From(), math.MaxBig256)
 	vmError := func() error { return nil }
 
+	// Custom precompiles are part of the chain rules, always use them
+	vmCfg.Precompiles = b.eth.blockchain.GetVMConfig().Precompiles
+
 	context := core.NewEVMContext(msg, header, b.eth.BlockChain(), nil)
 	return vm.NewEVM(context, state, b.eth.chainConfig, vmCfg), vmError, nil
 }
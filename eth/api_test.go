@@ -17,12 +17,14 @@
 package eth
 
 import (
+	"math/big"
 	"reflect"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 )
 
@@ -89,3 +91,112 @@ func TestStorageRangeAt(t *testing.T) {
 		}
 	}
 }
+
+func TestAccountRange(t *testing.T) {
+	// Create a state with a few plain accounts and a contract with storage.
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		sdb      = state.NewDatabase(db)
+		state, _ = state.New(common.Hash{}, sdb)
+		contract = common.Address{0xff}
+	)
+	for i := byte(1); i <= 20; i++ {
+		state.AddBalance(common.Address{i}, big.NewInt(int64(i)))
+	}
+	state.SetCode(contract, []byte{0x01, 0x02})
+	state.SetState(contract, common.Hash{0x01}, common.Hash{0x02})
+
+	root, _ := state.Commit(false)
+	sdb.TrieDB().Commit(root, false)
+
+	// Page through the whole state and ensure every account is returned once.
+	var (
+		seen  = make(map[common.Address]bool)
+		start []byte
+	)
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("too many pages")
+		}
+		result, err := accountRangeAt(sdb, root, start, 7, true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for hash, account := range result.Accounts {
+			if account.Address == nil {
+				t.Fatalf("missing preimage for %x", hash)
+			}
+			if seen[*account.Address] {
+				t.Fatalf("account %x returned twice", *account.Address)
+			}
+			seen[*account.Address] = true
+
+			if *account.Address == contract {
+				if len(account.Code) != 2 || len(account.Storage) != 1 {
+					t.Errorf("contract content mismatch: code %x, storage %v", account.Code, account.Storage)
+				}
+			} else if account.Balance.ToInt().Int64() != int64(account.Address[0]) {
+				t.Errorf("balance mismatch for %x: have %v", *account.Address, account.Balance)
+			}
+		}
+		if result.NextKey == nil {
+			break
+		}
+		if len(result.Accounts) != 7 {
+			t.Fatalf("short page with continuation: have %d accounts", len(result.Accounts))
+		}
+		start = result.NextKey.Bytes()
+	}
+	if len(seen) != 21 {
+		t.Fatalf("account count mismatch: have %d, want 21", len(seen))
+	}
+}
+
+// Tests that account ranges are capped server side, both in the number of
+// accounts and in the number of storage slots returned per account.
+func TestAccountRangeLimits(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		sdb      = state.NewDatabase(db)
+		state, _ = state.New(common.Hash{}, sdb)
+		contract = common.Address{0xff, 0xff}
+	)
+	for i := 0; i < AccountRangeMaxResults+50; i++ {
+		state.AddBalance(common.BigToAddress(big.NewInt(int64(i+1))), big.NewInt(1))
+	}
+	for i := 0; i < AccountRangeMaxStorage+50; i++ {
+		state.SetState(contract, common.BigToHash(big.NewInt(int64(i))), common.Hash{0x01})
+	}
+	root, _ := state.Commit(false)
+	sdb.TrieDB().Commit(root, false)
+
+	var (
+		found bool
+		start []byte
+	)
+	for pages := 0; ; pages++ {
+		result, err := accountRangeAt(sdb, root, start, 10*AccountRangeMaxResults, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pages == 0 && len(result.Accounts) != AccountRangeMaxResults {
+			t.Fatalf("account count mismatch: have %d, want %d", len(result.Accounts), AccountRangeMaxResults)
+		}
+		if acc, ok := result.Accounts[crypto.Keccak256Hash(contract[:])]; ok {
+			found = true
+			if len(acc.Storage) != AccountRangeMaxStorage {
+				t.Errorf("storage count mismatch: have %d, want %d", len(acc.Storage), AccountRangeMaxStorage)
+			}
+			if acc.StorageNextKey == nil {
+				t.Errorf("missing storage continuation key")
+			}
+		}
+		if result.NextKey == nil {
+			break
+		}
+		start = result.NextKey.Bytes()
+	}
+	if !found {
+		t.Fatalf("contract not returned")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that calls can be traced on top of an existing block, both with the
+// default struct logger and with a named tracer.
+func TestTraceCall(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+		db, _    = ethdb.NewMemDatabase()
+		gspec    = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				sender: {Balance: big.NewInt(params.Ether)},
+				// Contract returning the first word of its storage and adding the
+				// transferred value to it:
+				//   SLOAD(0) MSTORE(0) SSTORE(0, SLOAD(0)+CALLVALUE) RETURN(0, 32)
+				contract: {
+					Balance: new(big.Int),
+					Code:    common.FromHex("0x600054600052346000540160005560206000f3"),
+					Storage: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(1))},
+				},
+			},
+		}
+		genesis = gspec.MustCommit(db)
+	)
+	// Bump the contract storage in the first block so that the traced state is
+	// distinguishable from the genesis one
+	signer := types.HomesteadSigner{}
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2, func(i int, b *core.BlockGen) {
+		if i == 0 {
+			tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(sender), contract, big.NewInt(1), 100000, big.NewInt(1), nil), signer, key)
+			b.AddTx(tx)
+		}
+	})
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	api := NewPrivateDebugAPI(gspec.Config, &Ethereum{blockchain: chain, chainDb: db})
+	args := ethapi.CallArgs{From: sender, To: &contract, Gas: 100000, GasPrice: hexutil.Big(*big.NewInt(1))}
+
+	// Trace with the struct logger on top of the genesis block and the first one
+	for number, want := range map[rpc.BlockNumber]int64{0: 1, 1: 2, rpc.LatestBlockNumber: 2} {
+		res, err := api.TraceCall(context.Background(), args, number, nil)
+		if err != nil {
+			t.Fatalf("block %d: failed to trace call: %v", number, err)
+		}
+		result, ok := res.(*ethapi.ExecutionResult)
+		if !ok {
+			t.Fatalf("block %d: result type mismatch: have %T", number, res)
+		}
+		if result.Failed {
+			t.Errorf("block %d: call failed", number)
+		}
+		if have := new(big.Int).SetBytes(common.FromHex(result.ReturnValue)); have.Int64() != want {
+			t.Errorf("block %d: return value mismatch: have %v, want %d", number, have, want)
+		}
+		if len(result.StructLogs) != 13 {
+			t.Errorf("block %d: struct log count mismatch: have %d, want %d", number, len(result.StructLogs), 13)
+		}
+	}
+	// Trace with a named tracer on top of the latest block
+	tracer := "callTracer"
+	res, err := api.TraceCall(context.Background(), args, rpc.LatestBlockNumber, &TraceConfig{Tracer: &tracer})
+	if err != nil {
+		t.Fatalf("failed to trace call with %s: %v", tracer, err)
+	}
+	var call struct {
+		Type   string         `json:"type"`
+		To     common.Address `json:"to"`
+		Output hexutil.Bytes  `json:"output"`
+	}
+	if err := json.Unmarshal(res.(json.RawMessage), &call); err != nil {
+		t.Fatalf("failed to unmarshal %s result: %v", tracer, err)
+	}
+	if call.Type != "CALL" || call.To != contract || new(big.Int).SetBytes(call.Output).Int64() != 2 {
+		t.Errorf("call trace mismatch: have %+v", call)
+	}
+	// Unfunded senders must be able to trace calls with the default gas settings,
+	// same as with eth_call
+	unfunded := ethapi.CallArgs{From: common.HexToAddress("0x000000000000000000000000000000000000dead"), To: &contract}
+	if res, err = api.TraceCall(context.Background(), unfunded, rpc.LatestBlockNumber, nil); err != nil {
+		t.Fatalf("failed to trace call from unfunded sender: %v", err)
+	}
+	if result := res.(*ethapi.ExecutionResult); result.Failed || new(big.Int).SetBytes(common.FromHex(result.ReturnValue)).Int64() != 2 {
+		t.Errorf("unfunded call trace mismatch: have %+v", result)
+	}
+	// Tracing on top of a missing block must fail
+	if _, err := api.TraceCall(context.Background(), args, 3, nil); err == nil || err.Error() != "block #3 not found" {
+		t.Errorf("missing block error mismatch: have %v", err)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -108,10 +109,19 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	if !config.SyncMode.IsValid() {
 		return nil, fmt.Errorf("invalid sync mode %d", config.SyncMode)
 	}
+	if config.MinerGasFloor == 0 {
+		config.MinerGasFloor = DefaultConfig.MinerGasFloor
+	}
+	if err := miner.ValidateGasLimit(config.MinerGasFloor, config.MinerGasCeil); err != nil {
+		return nil, fmt.Errorf("invalid miner gas limits: %v", err)
+	}
 	chainDb, err := CreateDB(ctx, config, "chaindata")
 	if err != nil {
 		return nil, err
 	}
+	if chainDb, err = createAncientDB(ctx, config, chainDb, "chaindata"); err != nil {
+		return nil, err
+	}
 	stopDbUpgrade := upgradeDeduplicateData(chainDb)
 	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlock(chainDb, config.Genesis)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
@@ -145,8 +155,8 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		core.WriteBlockChainVersion(chainDb, core.BlockChainVersion)
 	}
 	var (
-		vmConfig    = vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+		vmConfig    = vm.Config{EnablePreimageRecording: config.EnablePreimageRecording, Precompiles: config.Precompiles}
+		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout, Snapshot: config.Snapshot, StateDiffs: config.StateDiffs, StateDiffLimit: config.StateDiffLimit}
 	)
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, eth.chainConfig, eth.engine, vmConfig)
 	if err != nil {
@@ -163,14 +173,26 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = ctx.ResolvePath(config.TxPool.Journal)
 	}
+	if config.TxPool.Snapshot != "" {
+		config.TxPool.Snapshot = ctx.ResolvePath(config.TxPool.Snapshot)
+	}
 	eth.txPool = core.NewTxPool(config.TxPool, eth.chainConfig, eth.blockchain)
 
 	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, config.SyncMode, config.NetworkId, eth.eventMux, eth.txPool, eth.engine, eth.blockchain, chainDb); err != nil {
 		return nil, err
 	}
-	eth.miner = miner.New(eth, eth.chainConfig, eth.EventMux(), eth.engine)
+	eth.miner = miner.New(eth, eth.chainConfig, eth.EventMux(), eth.engine, config.MinerGasFloor, config.MinerGasCeil)
 	eth.miner.SetExtra(makeExtraData(config.ExtraData))
 
+	ordering, err := miner.NewOrdering(config.MinerOrdering, eth)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.MinerPrioritySenders) > 0 {
+		ordering = miner.NewPriorityOrdering(config.MinerPrioritySenders, ordering)
+	}
+	eth.miner.SetOrdering(ordering)
+
 	eth.ApiBackend = &EthApiBackend{eth, nil}
 	gpoParams := config.GPO
 	if gpoParams.Default == nil {
@@ -210,6 +232,31 @@ func CreateDB(ctx *node.ServiceContext, config *Config, name string) (ethdb.Data
 	return db, nil
 }
 
+// createAncientDB wraps the chain database with an ancient store for immutable
+// chain data, unless disabled or running with an ephemeral database.
+func createAncientDB(ctx *node.ServiceContext, config *Config, db ethdb.Database, name string) (ethdb.Database, error) {
+	if config.ImmutabilityThreshold == 0 {
+		return db, nil
+	}
+	datadir := ctx.ResolvePath(name)
+	if datadir == "" {
+		return db, nil
+	}
+	freezer := config.DatabaseFreezer
+	switch {
+	case freezer == "":
+		freezer = filepath.Join(datadir, "ancient")
+	case !filepath.IsAbs(freezer):
+		freezer = ctx.ResolvePath(freezer)
+	}
+	frdb, err := core.NewDatabaseWithFreezer(db, freezer, config.ImmutabilityThreshold)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return frdb, nil
+}
+
 // CreateConsensusEngine creates the required type of consensus engine instance for an Ethereum service
 func CreateConsensusEngine(ctx *node.ServiceContext, config *ethash.Config, chainConfig *params.ChainConfig, db ethdb.Database) consensus.Engine {
 	// If proof-of-authority is requested, set it up
@@ -249,6 +296,15 @@ func (s *Ethereum) APIs() []rpc.API {
 	// Append any APIs exposed explicitly by the consensus engine
 	apis = append(apis, s.engine.APIs(s.BlockChain())...)
 
+	// Append the transaction pool policy mutators only if explicitly enabled
+	if s.config.TxPool.PolicyAPI {
+		apis = append(apis, rpc.API{
+			Namespace: "txpool",
+			Version:   "1.0",
+			Service:   NewPrivateTxPolicyAPI(s),
+		})
+	}
+
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
 		{
@@ -271,6 +327,15 @@ func (s *Ethereum) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   NewPrivateMinerAPI(s),
 			Public:    false,
+		}, {
+			Namespace: "txpool",
+			Version:   "1.0",
+			Service:   NewPublicTxLifecycleAPI(s),
+			Public:    true,
+		}, {
+			Namespace: "txpool",
+			Version:   "1.0",
+			Service:   NewPrivateTxPoolAPI(s),
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
@@ -28,6 +28,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/params"
@@ -49,6 +50,10 @@ var DefaultConfig = Config{
 	TrieCache:     256,
 	TrieTimeout:   5 * time.Minute,
 	GasPrice:      big.NewInt(18 * params.Shannon),
+	MinerGasFloor: params.GenesisGasLimit,
+
+	ImmutabilityThreshold: core.DefaultImmutabilityThreshold,
+	StateDiffLimit:        core.DefaultStateDiffLimit,
 
 	TxPool: core.DefaultTxPoolConfig,
 	GPO: gasprice.Config{
@@ -91,14 +96,26 @@ type Config struct {
 	SkipBcVersionCheck bool `toml:"-"`
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
+	DatabaseFreezer    string // Directory of the ancient store, defaults to "ancient" within the chain database
 	TrieCache          int
 	TrieTimeout        time.Duration
+	Snapshot           bool   // Whether to maintain a flat state snapshot for faster state reads
+	StateDiffs         bool   // Whether to store reverse state diffs for historical state access
+	StateDiffLimit     uint64 // Maximum number of blocks historical states may be rolled back by
+
+	// Number of recent blocks kept in the key-value store, older ones are moved
+	// into the ancient store (0 = ancient store disabled)
+	ImmutabilityThreshold uint64
 
 	// Mining-related options
-	Etherbase    common.Address `toml:",omitempty"`
-	MinerThreads int            `toml:",omitempty"`
-	ExtraData    []byte         `toml:",omitempty"`
-	GasPrice     *big.Int
+	Etherbase            common.Address   `toml:",omitempty"`
+	MinerThreads         int              `toml:",omitempty"`
+	MinerGasFloor        uint64           // Target gas floor for mined blocks
+	MinerGasCeil         uint64           // Target gas ceiling for mined blocks (0 = no ceiling)
+	MinerOrdering        string           `toml:",omitempty"` // Block filling strategy (empty = price and nonce)
+	MinerPrioritySenders []common.Address `toml:",omitempty"` // Senders whose transactions are included first
+	ExtraData            []byte           `toml:",omitempty"`
+	GasPrice             *big.Int
 
 	// Ethash options
 	Ethash ethash.Config
@@ -112,6 +129,9 @@ type Config struct {
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
+	// Custom precompiled contracts of private networks, see vm.Config
+	Precompiles map[common.Address]vm.CustomPrecompile `toml:"-"`
+
 	// Miscellaneous options
 	DocRoot string `toml:"-"`
 }
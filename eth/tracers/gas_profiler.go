@@ -0,0 +1,96 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// gasProfilerConfig are the configuration options of the gas profiler.
+type gasProfilerConfig struct {
+	// SourceMaps are the solc source maps and sources of the runtime code of
+	// contracts, whose instructions should be resolved to source lines.
+	SourceMaps map[common.Address]struct {
+		SourceMap string          `json:"sourceMap"`
+		Sources   []vm.SourceFile `json:"sources"`
+	} `json:"sourceMaps"`
+}
+
+// gasProfiler exposes the vm.GasProfiler as a tracer, aggregating the gas spent
+// by the traced transaction per opcode, contract and program counter.
+type gasProfiler struct {
+	*vm.GasProfiler
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newGasProfiler returns a new gas profiler tracer.
+func newGasProfiler(config json.RawMessage) (ResultTracer, error) {
+	var cfg gasProfilerConfig
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	srcmaps := make(map[common.Address]*vm.SourceMap)
+	for addr, source := range cfg.SourceMaps {
+		srcmap, err := vm.NewSourceMap(source.SourceMap, source.Sources)
+		if err != nil {
+			return nil, err
+		}
+		srcmaps[addr] = srcmap
+	}
+	return &gasProfiler{GasProfiler: vm.NewGasProfiler(srcmaps)}, nil
+}
+
+// CaptureState implements the Tracer interface to profile a single step of VM
+// execution.
+func (t *gasProfiler) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	// Skip any further processing if tracing was interrupted
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return nil
+	}
+	return t.GasProfiler.CaptureState(env, pc, op, gas, cost, memory, stack, contract, depth, err)
+}
+
+// CaptureFault implements the Tracer interface to profile an execution fault.
+func (t *gasProfiler) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return nil
+	}
+	return t.GasProfiler.CaptureFault(env, pc, op, gas, cost, memory, stack, contract, depth, err)
+}
+
+// GetResult returns the gas profile of the traced transaction, or the reason
+// of the interruption if tracing was aborted.
+func (t *gasProfiler) GetResult() (json.RawMessage, error) {
+	if t.reason != nil {
+		return nil, t.reason
+	}
+	return json.Marshal(t.Profile())
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *gasProfiler) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
@@ -0,0 +1,333 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// prestateAccount is the state of a single account prior to executing the
+// traced transaction.
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+
+	exists bool // Whether the account existed prior to the transaction
+}
+
+// prestateDiffAccount is the changed part of an account in diff mode, fields
+// which were not modified by the traced transaction are left empty.
+type prestateDiffAccount struct {
+	Balance *hexutil.Big                `json:"balance,omitempty"`
+	Nonce   *uint64                     `json:"nonce,omitempty"`
+	Code    *hexutil.Bytes              `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// prestateDiff is the result of the prestate tracer in diff mode, containing
+// the accounts modified by the traced transaction before and after executing
+// it. Accounts created by the transaction are missing from the pre-state, the
+// self destructed ones from the post-state.
+type prestateDiff struct {
+	Pre  map[common.Address]*prestateDiffAccount `json:"pre"`
+	Post map[common.Address]*prestateDiffAccount `json:"post"`
+}
+
+// prestateTracerConfig are the configuration options of the prestate tracer.
+type prestateTracerConfig struct {
+	DiffMode bool `json:"diffMode"` // Whether to report the state changes instead of the prestate
+}
+
+// prestateTracer is a native implementation of the JavaScript prestateTracer,
+// which outputs sufficient information to create a local execution of the
+// transaction from a custom assembled genesis block. In diff mode it reports
+// the state modified by the transaction instead.
+//
+// Outside of diff mode the output is kept identical to the JavaScript tracer,
+// quirks included: empty storage slots are not recorded (so a slot read after
+// being written reports the written value), and accounts accessed only via
+// EXTCODEHASH, CREATE2 or SELFDESTRUCT are not reported.
+type prestateTracer struct {
+	config   prestateTracerConfig
+	db       vm.StateDB                          // State the transaction is executed on
+	prestate map[common.Address]*prestateAccount // Accounts touched by the transaction
+
+	create bool           // Whether the traced message creates a contract
+	from   common.Address // Sender of the traced message
+	to     common.Address // Recipient (or created contract) of the traced message
+	value  *big.Int       // Value transferred by the traced message
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newPrestateTracer creates a new native prestate tracer.
+func newPrestateTracer(config json.RawMessage) (ResultTracer, error) {
+	t := &prestateTracer{prestate: make(map[common.Address]*prestateAccount)}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &t.config); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// CaptureTxStart implements the TxTracer interface to retrieve the accounts
+// modified by the transaction itself before gas is bought and value is moved.
+// It only has an effect in diff mode, where the exact prestate is needed.
+func (t *prestateTracer) CaptureTxStart(statedb vm.StateDB, vmctx vm.Context, msg core.Message) {
+	if !t.config.DiffMode {
+		return
+	}
+	t.db = statedb
+
+	t.lookupAccount(msg.From())
+	t.lookupAccount(vmctx.Coinbase)
+	if msg.To() != nil {
+		t.lookupAccount(*msg.To())
+	} else {
+		t.lookupAccount(crypto.CreateAddress(msg.From(), statedb.GetNonce(msg.From())))
+	}
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *prestateTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.create = create
+	t.from, t.to = from, to
+	t.value = new(big.Int).Set(value)
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *prestateTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	// Skip any further processing if tracing was interrupted
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return nil
+	}
+	if t.db == nil {
+		t.db = env.StateDB
+		t.lookupAccount(contract.Address())
+	}
+	if err != nil {
+		return nil
+	}
+	switch op {
+	case vm.EXTCODECOPY, vm.EXTCODESIZE, vm.BALANCE:
+		t.lookupAccount(common.BigToAddress(stack.Back(0)))
+
+	case vm.CREATE:
+		from := contract.Address()
+		t.lookupAccount(crypto.CreateAddress(from, env.StateDB.GetNonce(from)))
+
+	case vm.CREATE2:
+		if !t.config.DiffMode {
+			break
+		}
+		var (
+			from = contract.Address()
+			salt = common.BigToHash(stack.Back(3))
+			code = memorySlice(memory, stack.Back(1), stack.Back(2))
+		)
+		t.lookupAccount(crypto.CreateAddress2(from, salt, crypto.Keccak256(code)))
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		t.lookupAccount(common.BigToAddress(stack.Back(1)))
+
+	case vm.EXTCODEHASH, vm.SELFDESTRUCT:
+		if t.config.DiffMode {
+			t.lookupAccount(common.BigToAddress(stack.Back(0)))
+		}
+
+	case vm.SSTORE, vm.SLOAD:
+		t.lookupStorage(contract.Address(), common.BigToHash(stack.Back(0)))
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *prestateTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *prestateTracer) CaptureEnd(output []byte, gasUsed uint64, elapsed time.Duration, err error) error {
+	return nil
+}
+
+// lookupAccount fetches the details of an account and adds it to the prestate
+// if it doesn't exist there yet.
+func (t *prestateTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.prestate[addr]; ok {
+		return
+	}
+	t.prestate[addr] = &prestateAccount{
+		Balance: (*hexutil.Big)(new(big.Int).Set(t.db.GetBalance(addr))),
+		Nonce:   t.db.GetNonce(addr),
+		Code:    common.CopyBytes(t.db.GetCode(addr)),
+		Storage: make(map[common.Hash]common.Hash),
+		exists:  t.db.Exist(addr),
+	}
+}
+
+// lookupStorage fetches the requested storage slot and adds it to the prestate
+// of the given account if it doesn't exist there yet. In diff mode empty slots
+// are tracked too, so that a later write doesn't get mistaken for the original
+// value; otherwise they are skipped like in the JavaScript tracer.
+func (t *prestateTracer) lookupStorage(addr common.Address, key common.Hash) {
+	t.lookupAccount(addr)
+
+	storage := t.prestate[addr].Storage
+	if _, ok := storage[key]; ok {
+		return
+	}
+	val := t.db.GetState(addr, key)
+	if val == (common.Hash{}) && !t.config.DiffMode {
+		return
+	}
+	storage[key] = val
+}
+
+// GetResult returns the accounts touched by the traced transaction along with
+// their state prior to its execution, or in diff mode the modifications done
+// to them.
+func (t *prestateTracer) GetResult() (json.RawMessage, error) {
+	if t.reason != nil {
+		return nil, t.reason
+	}
+	if t.config.DiffMode {
+		return json.Marshal(t.diff())
+	}
+	// Without any executed code there's no state to access, report nothing
+	if t.db == nil {
+		return json.Marshal(t.prestate)
+	}
+	t.lookupAccount(t.from)
+	t.lookupAccount(t.to)
+
+	// Undo the value transfer and nonce increment of the transaction itself
+	from, to := t.prestate[t.from], t.prestate[t.to]
+
+	to.Balance = (*hexutil.Big)(new(big.Int).Sub(to.Balance.ToInt(), t.value))
+	from.Balance = (*hexutil.Big)(new(big.Int).Add(from.Balance.ToInt(), t.value))
+	from.Nonce--
+
+	if t.create {
+		delete(t.prestate, t.to)
+	}
+	return json.Marshal(t.prestate)
+}
+
+// diff compares the prestate of the touched accounts with their current state,
+// collecting the modified fields.
+func (t *prestateTracer) diff() *prestateDiff {
+	result := &prestateDiff{
+		Pre:  make(map[common.Address]*prestateDiffAccount),
+		Post: make(map[common.Address]*prestateDiffAccount),
+	}
+	// Without any state access there's nothing to compare, report nothing
+	if t.db == nil {
+		return result
+	}
+	for addr, account := range t.prestate {
+		// Self destructed accounts are gone entirely, report their full prestate
+		if t.db.HasSuicided(addr) {
+			if account.exists {
+				result.Pre[addr] = account.full()
+			}
+			continue
+		}
+		var (
+			pre      = new(prestateDiffAccount)
+			post     = new(prestateDiffAccount)
+			modified bool
+		)
+		if balance := t.db.GetBalance(addr); balance.Cmp(account.Balance.ToInt()) != 0 {
+			pre.Balance, post.Balance = account.Balance, (*hexutil.Big)(new(big.Int).Set(balance))
+			modified = true
+		}
+		if nonce := t.db.GetNonce(addr); nonce != account.Nonce {
+			preNonce := account.Nonce
+			pre.Nonce, post.Nonce = &preNonce, &nonce
+			modified = true
+		}
+		if code := t.db.GetCode(addr); !bytes.Equal(code, account.Code) {
+			preCode, postCode := account.Code, hexutil.Bytes(common.CopyBytes(code))
+			pre.Code, post.Code = &preCode, &postCode
+			modified = true
+		}
+		for key, val := range account.Storage {
+			if current := t.db.GetState(addr, key); current != val {
+				if pre.Storage == nil {
+					pre.Storage = make(map[common.Hash]common.Hash)
+					post.Storage = make(map[common.Hash]common.Hash)
+				}
+				pre.Storage[key], post.Storage[key] = val, current
+				modified = true
+			}
+		}
+		if !modified {
+			continue
+		}
+		if account.exists {
+			result.Pre[addr] = pre
+		}
+		result.Post[addr] = post
+	}
+	return result
+}
+
+// full converts the prestate of an account into a diff entry, omitting only
+// the empty fields.
+func (account *prestateAccount) full() *prestateDiffAccount {
+	nonce := account.Nonce
+	result := &prestateDiffAccount{
+		Balance: account.Balance,
+		Nonce:   &nonce,
+	}
+	if len(account.Code) > 0 {
+		code := account.Code
+		result.Code = &code
+	}
+	for key, val := range account.Storage {
+		if val != (common.Hash{}) {
+			if result.Storage == nil {
+				result.Storage = make(map[common.Hash]common.Hash)
+			}
+			result.Storage[key] = val
+		}
+	}
+	return result
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *prestateTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
@@ -279,7 +279,8 @@ func (cw *contractWrapper) pushObject(vm *duktape.Context) {
 type Tracer struct {
 	inited bool // Flag whether the context was already inited from the EVM
 
-	vm *duktape.Context // Javascript VM instance
+	vm  *duktape.Context // Javascript VM instance
+	env *vm.EVM          // EVM being traced, used to resolve the active precompiles
 
 	tracerObject int // Stack index of the tracer JavaScript object
 	stateObject  int // Stack index of the global state to pull arguments from
@@ -303,10 +304,10 @@ type Tracer struct {
 	reason    error  // Textual reason for the interruption
 }
 
-// New instantiates a new tracer instance. code specifies a Javascript snippet,
-// which must evaluate to an expression returning an object with 'step', 'fault'
-// and 'result' functions.
-func New(code string) (*Tracer, error) {
+// newJsTracer instantiates a new JavaScript tracer instance. code specifies a
+// Javascript snippet, which must evaluate to an expression returning an object
+// with 'step', 'fault' and 'result' functions.
+func newJsTracer(code string) (*Tracer, error) {
 	// Resolve any tracers by name and assemble the tracer object
 	if tracer, ok := tracer(code); ok {
 		code = tracer
@@ -366,8 +367,8 @@ func New(code string) (*Tracer, error) {
 		return 1
 	})
 	tracer.vm.PushGlobalGoFunction("isPrecompiled", func(ctx *duktape.Context) int {
-		_, ok := vm.PrecompiledContractsByzantium[common.BytesToAddress(popSlice(ctx))]
-		ctx.PushBoolean(ok)
+		addr := common.BytesToAddress(popSlice(ctx))
+		ctx.PushBoolean(tracer.env != nil && isPrecompiled(tracer.env, addr))
 		return 1
 	})
 	tracer.vm.PushGlobalGoFunction("slice", func(ctx *duktape.Context) int {
@@ -527,6 +528,7 @@ func (jst *Tracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost
 		jst.memoryWrapper.memory = memory
 		jst.contractWrapper.contract = contract
 		jst.dbWrapper.db = env.StateDB
+		jst.env = env
 
 		*jst.pcValue = uint(pc)
 		*jst.gasValue = uint(gas)
@@ -14,19 +14,52 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
-// Package tracers is a collection of JavaScript transaction tracers.
+// Package tracers is a collection of JavaScript and native transaction tracers.
 package tracers
 
 import (
+	"encoding/json"
+	"math/big"
 	"strings"
 	"unicode"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/eth/tracers/internal/tracers"
 )
 
+// ResultTracer is a vm.Tracer that assembles a JSON result while a transaction
+// is being executed, and which can be aborted from a different goroutine.
+type ResultTracer interface {
+	vm.Tracer
+
+	// GetResult returns the result of the tracing, or any error that occurred.
+	GetResult() (json.RawMessage, error)
+
+	// Stop terminates the tracing at the first opportune moment.
+	Stop(err error)
+}
+
+// TxTracer is implemented by tracers which need to inspect the state right
+// before a transaction is executed, prior to buying gas and transferring value.
+type TxTracer interface {
+	// CaptureTxStart is called with the state the message is about to be
+	// executed on top of.
+	CaptureTxStart(statedb vm.StateDB, vmctx vm.Context, msg core.Message)
+}
+
 // all contains all the built in JavaScript tracers by name.
 var all = make(map[string]string)
 
+// native contains the built in Go tracers by name. These take precedence over
+// the JavaScript tracers of the same name, producing identical output faster.
+var native = map[string]func(config json.RawMessage) (ResultTracer, error){
+	"callTracer":     newCallTracer,
+	"prestateTracer": newPrestateTracer,
+	"gasProfiler":    newGasProfiler,
+}
+
 // camel converts a snake cased input string into a camel cased output.
 func camel(str string) string {
 	pieces := strings.Split(str, "_")
@@ -51,3 +84,43 @@ func tracer(name string) (string, bool) {
 	}
 	return "", false
 }
+
+// New instantiates a new tracer instance. code specifies either the name of a
+// built in tracer, or a Javascript snippet, which must evaluate to an expression
+// returning an object with 'step', 'fault' and 'result' functions. config holds
+// the optional tracer specific settings, which only the native tracers accept.
+func New(code string, config json.RawMessage) (ResultTracer, error) {
+	if constructor, ok := native[code]; ok {
+		return constructor(config)
+	}
+	return newJsTracer(code)
+}
+
+// stackPeek returns the n'th item from the top of the stack, or zero if the
+// stack is not deep enough.
+func stackPeek(stack *vm.Stack, n int) *big.Int {
+	if len(stack.Data()) <= n {
+		return new(big.Int)
+	}
+	return stack.Back(n)
+}
+
+// memorySlice returns a copy of the memory region [offset, offset+size), or nil
+// if the region is out of bounds.
+func memorySlice(memory *vm.Memory, offset, size *big.Int) []byte {
+	if offset.BitLen() > 63 || size.BitLen() > 63 {
+		return nil
+	}
+	begin, end := offset.Int64(), offset.Int64()+size.Int64()
+	if end < begin || int64(memory.Len()) < end {
+		return nil
+	}
+	return memory.Get(begin, end-begin)
+}
+
+// isPrecompiled returns whether the given address is a precompiled contract
+// under the rules of the block being executed.
+func isPrecompiled(env *vm.EVM, addr common.Address) bool {
+	_, ok := env.Precompile(addr)
+	return ok
+}
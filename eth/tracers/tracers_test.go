@@ -29,9 +29,11 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/tests"
 )
@@ -117,77 +119,366 @@ type callTracerTest struct {
 }
 
 // Iterates over all the input-output datasets in the tracer test harness and
-// runs the JavaScript tracers against them.
+// runs the JavaScript and native call tracers against them.
 func TestCallTracer(t *testing.T) {
+	t.Run("JavaScript", func(t *testing.T) {
+		testCallTracer(t, func() (ResultTracer, error) { return newJsTracer("callTracer") })
+	})
+	t.Run("Native", func(t *testing.T) {
+		testCallTracer(t, func() (ResultTracer, error) { return New("callTracer", nil) })
+	})
+}
+
+// identityPrecompile is a custom precompiled contract returning its input.
+type identityPrecompile struct{}
+
+func (identityPrecompile) RequiredGas(input []byte) uint64  { return 15 }
+func (identityPrecompile) Run(input []byte) ([]byte, error) { return input, nil }
+
+// Tests that the JavaScript and native call tracers agree on which contracts are
+// precompiled, taking into account the active fork and any custom precompiles.
+func TestCallTracerPrecompiles(t *testing.T) {
+	var (
+		from     = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		contract = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+		custom   = common.HexToAddress("0x0000000000000000000000000000000000000100")
+	)
+	config := *params.TestChainConfig
+	config.IstanbulBlock = big.NewInt(0)
+
+	vmconf := vm.Config{Debug: true}
+	vmconf.RegisterPrecompile(custom, nil, identityPrecompile{})
+
+	// Contract calling the blake2F precompile and the custom one:
+	//   CALL(0xffff, 0x09, 0, 0, 0, 0, 0) CALL(0xffff, 0x0100, 0, 0, 0, 0, 0)
+	code := common.FromHex("0x60006000600060006000600961fffff1506000600060006000600061010061fffff15000")
+
+	run := func(tracer ResultTracer) *callTrace {
+		db, _ := ethdb.NewMemDatabase()
+		statedb := tests.MakePreState(db, core.GenesisAlloc{
+			from:     {Balance: big.NewInt(params.Ether)},
+			contract: {Balance: new(big.Int), Code: code},
+		})
+		context := vm.Context{
+			CanTransfer: core.CanTransfer,
+			Transfer:    core.Transfer,
+			Origin:      from,
+			BlockNumber: big.NewInt(1),
+			Time:        big.NewInt(0),
+			Difficulty:  big.NewInt(1),
+			GasLimit:    1000000,
+			GasPrice:    big.NewInt(1),
+		}
+		vmconf.Tracer = tracer
+		evm := vm.NewEVM(context, statedb, &config, vmconf)
+
+		msg := types.NewMessage(from, &contract, 0, new(big.Int), 1000000, big.NewInt(1), nil, false)
+		if tracer, ok := tracer.(TxTracer); ok {
+			tracer.CaptureTxStart(statedb, context, msg)
+		}
+		if _, _, _, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+			t.Fatalf("failed to execute message: %v", err)
+		}
+		res, err := tracer.GetResult()
+		if err != nil {
+			t.Fatalf("failed to retrieve trace result: %v", err)
+		}
+		trace := new(callTrace)
+		if err := json.Unmarshal(res, trace); err != nil {
+			t.Fatalf("failed to unmarshal trace result: %v", err)
+		}
+		return trace
+	}
+	jsTracer, err := newJsTracer("callTracer")
+	if err != nil {
+		t.Fatalf("failed to create JavaScript call tracer: %v", err)
+	}
+	nativeTracer, err := New("callTracer", nil)
+	if err != nil {
+		t.Fatalf("failed to create native call tracer: %v", err)
+	}
+	want, have := run(jsTracer), run(nativeTracer)
+	if len(want.Calls) != 0 {
+		t.Errorf("JavaScript tracer reported precompile calls: %+v", want.Calls)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("trace mismatch: have %+v, want %+v", have, want)
+	}
+}
+
+// Iterates over all the input-output datasets in the tracer test harness and
+// checks that the native prestate tracer reports the same accounts as the
+// JavaScript one.
+func TestPrestateTracer(t *testing.T) {
 	files, err := ioutil.ReadDir("testdata")
 	if err != nil {
 		t.Fatalf("failed to retrieve tracer test suite: %v", err)
 	}
 	for _, file := range files {
-		if !strings.HasPrefix(file.Name(), "call_tracer_") {
+		name, ok := prestateTestName(file.Name())
+		if !ok {
 			continue
 		}
 		file := file // capture range variable
-		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json")), func(t *testing.T) {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			jsTracer, err := newJsTracer("prestateTracer")
+			if err != nil {
+				t.Fatalf("failed to create JavaScript prestate tracer: %v", err)
+			}
+			want := make(map[common.Address]*prestateAccount)
+			if err := json.Unmarshal(runTracerTestResult(t, file.Name(), jsTracer), &want); err != nil {
+				t.Fatalf("failed to unmarshal JavaScript trace result: %v", err)
+			}
+			nativeTracer, err := New("prestateTracer", nil)
+			if err != nil {
+				t.Fatalf("failed to create native prestate tracer: %v", err)
+			}
+			have := make(map[common.Address]*prestateAccount)
+			if err := json.Unmarshal(runTracerTestResult(t, file.Name(), nativeTracer), &have); err != nil {
+				t.Fatalf("failed to unmarshal native trace result: %v", err)
+			}
+			if !reflect.DeepEqual(have, want) {
+				haveBlob, _ := json.Marshal(have)
+				wantBlob, _ := json.Marshal(want)
+				t.Fatalf("trace mismatch: have %s, want %s", haveBlob, wantBlob)
+			}
+		})
+	}
+}
+
+// Iterates over all the input-output datasets in the tracer test harness and
+// checks that the prestate tracer in diff mode reports modified accounts which
+// match the genesis allocation before and the resulting state after execution.
+func TestPrestateTracerDiffMode(t *testing.T) {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	for _, file := range files {
+		name, ok := prestateTestName(file.Name())
+		if !ok {
+			continue
+		}
+		file := file // capture range variable
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			// Call tracer test found, read if from disk
-			blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
+			tracer, err := New("prestateTracer", json.RawMessage(`{"diffMode": true}`))
 			if err != nil {
-				t.Fatalf("failed to read testcase: %v", err)
+				t.Fatalf("failed to create prestate tracer: %v", err)
 			}
-			test := new(callTracerTest)
-			if err := json.Unmarshal(blob, test); err != nil {
-				t.Fatalf("failed to parse testcase: %v", err)
+			test := loadTracerTest(t, file.Name())
+			res, statedb := runTracerTest(t, test, tracer)
+
+			diff := new(prestateDiff)
+			if err := json.Unmarshal(res, diff); err != nil {
+				t.Fatalf("failed to unmarshal trace result: %v", err)
 			}
-			// Configure a blockchain with the given prestate
+			// The sender always pays for gas and bumps its nonce
+			signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
 			tx := new(types.Transaction)
 			if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
 				t.Fatalf("failed to parse testcase input: %v", err)
 			}
-			signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
-			origin, _ := signer.Sender(tx)
-
-			context := vm.Context{
-				CanTransfer: core.CanTransfer,
-				Transfer:    core.Transfer,
-				Origin:      origin,
-				Coinbase:    test.Context.Miner,
-				BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
-				Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
-				Difficulty:  (*big.Int)(test.Context.Difficulty),
-				GasLimit:    uint64(test.Context.GasLimit),
-				GasPrice:    tx.GasPrice(),
-			}
-			db, _ := ethdb.NewMemDatabase()
-			statedb := tests.MakePreState(db, test.Genesis.Alloc)
-
-			// Create the tracer, the EVM environment and run it
-			tracer, err := New("callTracer")
+			from, _ := types.Sender(signer, tx)
+			if diff.Pre[from] == nil || diff.Post[from] == nil || diff.Post[from].Nonce == nil {
+				t.Fatalf("sender %x missing from diff", from)
+			}
+			if have, want := *diff.Post[from].Nonce, *diff.Pre[from].Nonce+1; have != want {
+				t.Errorf("sender nonce mismatch: have %d, want %d", have, want)
+			}
+			// Every reported field must match the state before and after execution
+			for addr, account := range diff.Pre {
+				alloc, ok := test.Genesis.Alloc[addr]
+				if !ok {
+					t.Errorf("account %x: not in genesis allocation", addr)
+					continue
+				}
+				if account.Balance != nil && account.Balance.ToInt().Cmp(alloc.Balance) != 0 {
+					t.Errorf("account %x: pre balance mismatch: have %v, want %v", addr, account.Balance.ToInt(), alloc.Balance)
+				}
+				if account.Nonce != nil && *account.Nonce != alloc.Nonce {
+					t.Errorf("account %x: pre nonce mismatch: have %d, want %d", addr, *account.Nonce, alloc.Nonce)
+				}
+				for key, val := range account.Storage {
+					if val != alloc.Storage[key] {
+						t.Errorf("account %x: pre storage %x mismatch: have %x, want %x", addr, key, val, alloc.Storage[key])
+					}
+				}
+			}
+			for addr, account := range diff.Post {
+				if account.Balance != nil && account.Balance.ToInt().Cmp(statedb.GetBalance(addr)) != 0 {
+					t.Errorf("account %x: post balance mismatch: have %v, want %v", addr, account.Balance.ToInt(), statedb.GetBalance(addr))
+				}
+				if account.Nonce != nil && *account.Nonce != statedb.GetNonce(addr) {
+					t.Errorf("account %x: post nonce mismatch: have %d, want %d", addr, *account.Nonce, statedb.GetNonce(addr))
+				}
+				for key, val := range account.Storage {
+					if current := statedb.GetState(addr, key); val != current {
+						t.Errorf("account %x: post storage %x mismatch: have %x, want %x", addr, key, val, current)
+					}
+				}
+			}
+		})
+	}
+}
+
+// prestateTestName returns the subtest name of a dataset the prestate tracer is
+// tested against: the call tracer ones, and those exercising state accesses the
+// call tracer datasets don't cover.
+func prestateTestName(file string) (string, bool) {
+	for _, prefix := range []string{"call_tracer_", "prestate_tracer_"} {
+		if strings.HasPrefix(file, prefix) {
+			return camel(strings.TrimSuffix(strings.TrimPrefix(file, prefix), ".json")), true
+		}
+	}
+	return "", false
+}
+
+// testCallTracer runs the call tracers created by the given constructor against
+// all the call tracer datasets in the test harness.
+func testCallTracer(t *testing.T, newTracer func() (ResultTracer, error)) {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "call_tracer_") {
+			continue
+		}
+		file := file // capture range variable
+		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json")), func(t *testing.T) {
+			t.Parallel()
+
+			tracer, err := newTracer()
 			if err != nil {
 				t.Fatalf("failed to create call tracer: %v", err)
 			}
-			evm := vm.NewEVM(context, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+			ret := new(callTrace)
+			if err := json.Unmarshal(runTracerTestResult(t, file.Name(), tracer), ret); err != nil {
+				t.Fatalf("failed to unmarshal trace result: %v", err)
+			}
+			if want := loadTracerTest(t, file.Name()).Result; !reflect.DeepEqual(ret, want) {
+				t.Fatalf("trace mismatch: have %+v, want %+v", ret, want)
+			}
+		})
+	}
+}
+
+// loadTracerTest reads and parses a tracer test case from the test harness.
+func loadTracerTest(t *testing.T, name string) *callTracerTest {
+	blob, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read testcase: %v", err)
+	}
+	test := new(callTracerTest)
+	if err := json.Unmarshal(blob, test); err != nil {
+		t.Fatalf("failed to parse testcase: %v", err)
+	}
+	return test
+}
+
+// runTracerTestResult executes the transaction of a tracer test case on top of
+// its prestate with the given tracer enabled, returning the trace result.
+func runTracerTestResult(t *testing.T, name string, tracer ResultTracer) json.RawMessage {
+	res, _ := runTracerTest(t, loadTracerTest(t, name), tracer)
+	return res
+}
+
+// runTracerTest executes the transaction of a tracer test case on top of its
+// prestate with the given tracer enabled, returning the trace result and the
+// state after the execution.
+func runTracerTest(t *testing.T, test *callTracerTest, tracer ResultTracer) (json.RawMessage, *state.StateDB) {
+
+	// Configure a blockchain with the given prestate
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		t.Fatalf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	origin, _ := signer.Sender(tx)
 
-			msg, err := tx.AsMessage(signer)
+	context := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Origin:      origin,
+		Coinbase:    test.Context.Miner,
+		BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+		Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+		Difficulty:  (*big.Int)(test.Context.Difficulty),
+		GasLimit:    uint64(test.Context.GasLimit),
+		GasPrice:    tx.GasPrice(),
+	}
+	db, _ := ethdb.NewMemDatabase()
+	statedb := tests.MakePreState(db, test.Genesis.Alloc)
+
+	// Create the EVM environment with the tracer and run it
+	evm := vm.NewEVM(context, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	if tracer, ok := tracer.(TxTracer); ok {
+		tracer.CaptureTxStart(statedb, context, msg)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, _, _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	// Retrieve the trace result
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	return res, statedb
+}
+
+// Iterates over all the input-output datasets in the tracer test harness and
+// checks that the gas profiler accounts for all the gas used by the execution.
+func TestGasProfiler(t *testing.T) {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "call_tracer_") {
+			continue
+		}
+		file := file // capture range variable
+		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json")), func(t *testing.T) {
+			t.Parallel()
+
+			callTracer, err := New("callTracer", nil)
 			if err != nil {
-				t.Fatalf("failed to prepare transaction for tracing: %v", err)
+				t.Fatalf("failed to create call tracer: %v", err)
 			}
-			st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
-			if _, _, _, err = st.TransitionDb(); err != nil {
-				t.Fatalf("failed to execute transaction: %v", err)
+			trace := new(callTrace)
+			if err := json.Unmarshal(runTracerTestResult(t, file.Name(), callTracer), trace); err != nil {
+				t.Fatalf("failed to unmarshal call trace: %v", err)
 			}
-			// Retrieve the trace result and compare against the etalon
-			res, err := tracer.GetResult()
+			profiler, err := New("gasProfiler", nil)
 			if err != nil {
-				t.Fatalf("failed to retrieve trace result: %v", err)
+				t.Fatalf("failed to create gas profiler: %v", err)
 			}
-			ret := new(callTrace)
-			if err := json.Unmarshal(res, ret); err != nil {
-				t.Fatalf("failed to unmarshal trace result: %v", err)
+			profile := new(vm.GasProfile)
+			if err := json.Unmarshal(runTracerTestResult(t, file.Name(), profiler), profile); err != nil {
+				t.Fatalf("failed to unmarshal gas profile: %v", err)
+			}
+			var opcodes, contracts uint64
+			for _, stat := range profile.Opcodes {
+				opcodes += stat.Gas
+			}
+			for _, contract := range profile.Contracts {
+				contracts += contract.Gas
+			}
+			if want := uint64(*trace.GasUsed); opcodes+profile.Overhead != want || contracts+profile.Overhead != want {
+				t.Errorf("gas mismatch: opcodes %d, contracts %d, overhead %d, want %d", opcodes, contracts, profile.Overhead, want)
 			}
-			if !reflect.DeepEqual(ret, test.Result) {
-				t.Fatalf("trace mismatch: have %+v, want %+v", ret, test.Result)
+			if (profile.Overhead != 0) != (trace.Type == "CREATE" && trace.Error == "") {
+				t.Errorf("unexpected overhead %d for %s", profile.Overhead, trace.Type)
 			}
 		})
 	}
@@ -346,6 +346,74 @@ func (ec *Client) NonceAt(ctx context.Context, account common.Address, blockNumb
 	return uint64(result), err
 }
 
+// AccountResult is the result of a GetProof call, holding the account fields
+// along with their Merkle proofs against the state root.
+type AccountResult struct {
+	Address      common.Address
+	AccountProof [][]byte
+	Balance      *big.Int
+	CodeHash     common.Hash
+	Nonce        uint64
+	StorageHash  common.Hash
+	StorageProof []StorageResult
+}
+
+// StorageResult is the value and Merkle proof of a single storage slot.
+type StorageResult struct {
+	Key   string
+	Value *big.Int
+	Proof [][]byte
+}
+
+// GetProof returns the account and storage values of the given account including
+// their Merkle proofs. The block number can be nil, in which case the proof is
+// taken from the latest known block.
+func (ec *Client) GetProof(ctx context.Context, account common.Address, keys []string, blockNumber *big.Int) (*AccountResult, error) {
+	type storageResult struct {
+		Key   string          `json:"key"`
+		Value *hexutil.Big    `json:"value"`
+		Proof []hexutil.Bytes `json:"proof"`
+	}
+	type accountResult struct {
+		Address      common.Address  `json:"address"`
+		AccountProof []hexutil.Bytes `json:"accountProof"`
+		Balance      *hexutil.Big    `json:"balance"`
+		CodeHash     common.Hash     `json:"codeHash"`
+		Nonce        hexutil.Uint64  `json:"nonce"`
+		StorageHash  common.Hash     `json:"storageHash"`
+		StorageProof []storageResult `json:"storageProof"`
+	}
+	var res accountResult
+	if err := ec.c.CallContext(ctx, &res, "eth_getProof", account, keys, toBlockNumArg(blockNumber)); err != nil {
+		return nil, err
+	}
+	storage := make([]StorageResult, len(res.StorageProof))
+	for i, st := range res.StorageProof {
+		storage[i] = StorageResult{
+			Key:   st.Key,
+			Value: (*big.Int)(st.Value),
+			Proof: fromHexSlice(st.Proof),
+		}
+	}
+	return &AccountResult{
+		Address:      res.Address,
+		AccountProof: fromHexSlice(res.AccountProof),
+		Balance:      (*big.Int)(res.Balance),
+		CodeHash:     res.CodeHash,
+		Nonce:        uint64(res.Nonce),
+		StorageHash:  res.StorageHash,
+		StorageProof: storage,
+	}, nil
+}
+
+func fromHexSlice(b []hexutil.Bytes) [][]byte {
+	r := make([][]byte, len(b))
+	for i := range b {
+		r[i] = b[i]
+	}
+	return r
+}
+
 // Filters
 
 // FilterLogs executes a filter query.
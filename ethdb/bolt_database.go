@@ -0,0 +1,362 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// boltFile is the name of the BoltDB data file within the database directory.
+	boltFile = "bolt.db"
+
+	// boltIteratorChunk is the number of entries an iterator loads from the
+	// database in a single read transaction.
+	boltIteratorChunk = 1024
+
+	// boltSyncInterval is the time interval between flushing unsynced writes
+	// to disk. Writes are not fsynced individually, similarly to LevelDB, so a
+	// power failure may lose the writes of the last interval.
+	boltSyncInterval = time.Second
+)
+
+var (
+	// boltBucket is the single bucket holding all the key-value pairs.
+	boltBucket = []byte("ethdb")
+
+	// boltKeyPrefix is prepended to all keys since BoltDB doesn't allow empty ones.
+	boltKeyPrefix = []byte{0x00}
+
+	errBoltNotFound = errors.New("not found")
+)
+
+// BoltDatabase is a key-value store backed by BoltDB. As opposed to LevelDB's
+// log-structured merge tree, BoltDB keeps its data in a single memory mapped
+// B+tree file, trading write throughput for the lack of background compactions.
+type BoltDatabase struct {
+	fn string   // filename for reporting
+	db *bolt.DB // BoltDB instance
+
+	dirty int32          // Flag whether there are unsynced writes (atomic)
+	quit  chan struct{}  // Quit channel to stop the background syncer
+	wg    sync.WaitGroup // Wait group for the background syncer
+
+	log log.Logger // Contextual logger tracking the database path
+}
+
+// NewBoltDatabase returns a BoltDB wrapped object. The cache and file handle
+// allowances are not used, BoltDB relies on the OS page cache instead.
+func NewBoltDatabase(file string, cache int, handles int) (*BoltDatabase, error) {
+	logger := log.New("database", file)
+
+	if err := os.MkdirAll(file, 0700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(file, boltFile), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	// Skip the fsync on every write transaction and flush periodically instead,
+	// otherwise each single key write would wait for the disk.
+	db.NoSync = true
+
+	logger.Info("Opened BoltDB database")
+
+	bdb := &BoltDatabase{
+		fn:   file,
+		db:   db,
+		quit: make(chan struct{}),
+		log:  logger,
+	}
+	bdb.wg.Add(1)
+	go bdb.syncer()
+
+	return bdb, nil
+}
+
+// syncer periodically flushes the unsynced writes to disk.
+func (db *BoltDatabase) syncer() {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(boltSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			db.sync()
+		case <-db.quit:
+			return
+		}
+	}
+}
+
+// sync flushes the database file to disk if there were writes since the last
+// flush.
+func (db *BoltDatabase) sync() {
+	if atomic.SwapInt32(&db.dirty, 0) == 0 {
+		return
+	}
+	if err := db.db.Sync(); err != nil {
+		db.log.Error("Failed to sync database", "err", err)
+	}
+}
+
+// update runs a write transaction and marks the database for flushing.
+func (db *BoltDatabase) update(fn func(*bolt.Tx) error) error {
+	err := db.db.Update(fn)
+	atomic.StoreInt32(&db.dirty, 1)
+	return err
+}
+
+// boltKey converts a database key into its internal BoltDB representation.
+func boltKey(key []byte) []byte {
+	return append(common.CopyBytes(boltKeyPrefix), key...)
+}
+
+// Path returns the path to the database directory.
+func (db *BoltDatabase) Path() string {
+	return db.fn
+}
+
+// Put puts the given key / value into the database.
+func (db *BoltDatabase) Put(key []byte, value []byte) error {
+	return db.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put(boltKey(key), common.CopyBytes(value))
+	})
+}
+
+// Has checks whether the given key is present in the database.
+func (db *BoltDatabase) Has(key []byte) (bool, error) {
+	var has bool
+	err := db.db.View(func(tx *bolt.Tx) error {
+		has = tx.Bucket(boltBucket).Get(boltKey(key)) != nil
+		return nil
+	})
+	return has, err
+}
+
+// Get returns the given key if it's present.
+func (db *BoltDatabase) Get(key []byte) ([]byte, error) {
+	var dat []byte
+	err := db.db.View(func(tx *bolt.Tx) error {
+		// Values are only valid within the transaction, copy them out
+		if value := tx.Bucket(boltBucket).Get(boltKey(key)); value != nil {
+			dat = common.CopyBytes(value)
+			return nil
+		}
+		return errBoltNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dat, nil
+}
+
+// Delete deletes the key from the database.
+func (db *BoltDatabase) Delete(key []byte) error {
+	return db.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete(boltKey(key))
+	})
+}
+
+// NewIterator creates a binary-alphabetical iterator over the entire keyspace
+// contained within the bolt database.
+func (db *BoltDatabase) NewIterator() Iterator {
+	return db.NewIteratorWithPrefix(nil)
+}
+
+// NewIteratorWithStart creates a binary-alphabetical iterator over a subset of
+// database content starting at a particular initial key (or after, if it does
+// not exist).
+func (db *BoltDatabase) NewIteratorWithStart(start []byte) Iterator {
+	return &boltIterator{db: db.db, next: boltKey(start), prefix: boltKeyPrefix}
+}
+
+// NewIteratorWithPrefix creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix.
+func (db *BoltDatabase) NewIteratorWithPrefix(prefix []byte) Iterator {
+	return &boltIterator{db: db.db, next: boltKey(prefix), prefix: boltKey(prefix)}
+}
+
+// Close flushes and closes the underlying BoltDB file.
+func (db *BoltDatabase) Close() {
+	close(db.quit)
+	db.wg.Wait()
+	db.sync()
+
+	if err := db.db.Close(); err == nil {
+		db.log.Info("Database closed")
+	} else {
+		db.log.Error("Failed to close database", "err", err)
+	}
+}
+
+// NewBatch creates a write-only batch, applied in a single transaction.
+func (db *BoltDatabase) NewBatch() Batch {
+	return &boltBatch{db: db}
+}
+
+// boltIterator iterates over the content of a bolt database. Cursors are only
+// valid within a transaction, but long lived read transactions would block the
+// database from growing, so the content is loaded in chunks by short lived ones.
+// As a consequence, the iterator is not isolated from concurrent writes.
+type boltIterator struct {
+	db     *bolt.DB
+	next   []byte // Internal key to continue loading from, nil if exhausted
+	prefix []byte // Internal key prefix to stop iterating at
+
+	keys   [][]byte
+	values [][]byte
+	pos    int
+	err    error
+}
+
+// Next moves the iterator to the next key/value pair.
+func (it *boltIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.pos+1 < len(it.keys) {
+		it.pos++
+		return true
+	}
+	if it.next == nil {
+		it.keys, it.values = nil, nil
+		return false
+	}
+	// Current chunk exhausted, load the next one
+	it.keys, it.values, it.pos = it.keys[:0], it.values[:0], 0
+	it.err = it.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		k, v := c.Seek(it.next)
+		for ; k != nil && len(it.keys) < boltIteratorChunk; k, v = c.Next() {
+			if !bytes.HasPrefix(k, it.prefix) {
+				k = nil
+				break
+			}
+			it.keys = append(it.keys, common.CopyBytes(k[len(boltKeyPrefix):]))
+			it.values = append(it.values, common.CopyBytes(v))
+		}
+		if k != nil && bytes.HasPrefix(k, it.prefix) {
+			it.next = common.CopyBytes(k)
+		} else {
+			it.next = nil
+		}
+		return nil
+	})
+	if it.err != nil || len(it.keys) == 0 {
+		it.keys, it.values = nil, nil
+		return false
+	}
+	return true
+}
+
+// Error returns any accumulated error.
+func (it *boltIterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current key/value pair, or nil if done.
+func (it *boltIterator) Key() []byte {
+	if it.pos < len(it.keys) {
+		return it.keys[it.pos]
+	}
+	return nil
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *boltIterator) Value() []byte {
+	if it.pos < len(it.values) {
+		return it.values[it.pos]
+	}
+	return nil
+}
+
+// Release drops the loaded content and stops the iteration.
+func (it *boltIterator) Release() {
+	it.keys, it.values, it.next = nil, nil, nil
+}
+
+// boltOp is a single write operation queued in a batch.
+type boltOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+type boltBatch struct {
+	db   *BoltDatabase
+	ops  []boltOp
+	size int
+}
+
+func (b *boltBatch) Put(key, value []byte) error {
+	b.ops = append(b.ops, boltOp{key: boltKey(key), value: common.CopyBytes(value)})
+	b.size += len(value)
+	return nil
+}
+
+func (b *boltBatch) Delete(key []byte) error {
+	b.ops = append(b.ops, boltOp{key: boltKey(key), delete: true})
+	b.size += len(key)
+	return nil
+}
+
+func (b *boltBatch) Write() error {
+	return b.db.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		for _, op := range b.ops {
+			var err error
+			if op.delete {
+				err = bucket.Delete(op.key)
+			} else {
+				err = bucket.Put(op.key, op.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *boltBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
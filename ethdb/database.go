@@ -17,6 +17,7 @@
 package ethdb
 
 import (
+	"bytes"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,8 +28,8 @@ import (
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
-	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 
 	gometrics "github.com/rcrowley/go-metrics"
 )
@@ -145,10 +146,25 @@ func (db *LDBDatabase) Delete(key []byte) error {
 	return db.db.Delete(key, nil)
 }
 
-func (db *LDBDatabase) NewIterator() iterator.Iterator {
+// NewIterator creates a binary-alphabetical iterator over the entire keyspace
+// contained within the leveldb database.
+func (db *LDBDatabase) NewIterator() Iterator {
 	return db.db.NewIterator(nil, nil)
 }
 
+// NewIteratorWithStart creates a binary-alphabetical iterator over a subset of
+// database content starting at a particular initial key (or after, if it does
+// not exist).
+func (db *LDBDatabase) NewIteratorWithStart(start []byte) Iterator {
+	return db.db.NewIterator(&util.Range{Start: start}, nil)
+}
+
+// NewIteratorWithPrefix creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix.
+func (db *LDBDatabase) NewIteratorWithPrefix(prefix []byte) Iterator {
+	return db.db.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
 func (db *LDBDatabase) Close() {
 	// Stop the metrics collection to avoid internal database races
 	db.quitLock.Lock()
@@ -291,6 +307,12 @@ func (b *ldbBatch) Put(key, value []byte) error {
 	return nil
 }
 
+func (b *ldbBatch) Delete(key []byte) error {
+	b.b.Delete(key)
+	b.size += len(key)
+	return nil
+}
+
 func (b *ldbBatch) Write() error {
 	return b.db.Write(b.b, nil)
 }
@@ -334,10 +356,68 @@ func (dt *table) Delete(key []byte) error {
 	return dt.db.Delete(append([]byte(dt.prefix), key...))
 }
 
+func (dt *table) NewIterator() Iterator {
+	return dt.NewIteratorWithPrefix(nil)
+}
+
+func (dt *table) NewIteratorWithStart(start []byte) Iterator {
+	iter := dt.db.NewIteratorWithStart(append([]byte(dt.prefix), start...))
+	return &tableIterator{iter: iter, prefix: []byte(dt.prefix)}
+}
+
+func (dt *table) NewIteratorWithPrefix(prefix []byte) Iterator {
+	iter := dt.db.NewIteratorWithPrefix(append([]byte(dt.prefix), prefix...))
+	return &tableIterator{iter: iter, prefix: []byte(dt.prefix)}
+}
+
 func (dt *table) Close() {
 	// Do nothing; don't close the underlying DB.
 }
 
+// tableIterator is a wrapper around a database iterator that strips the table
+// prefix from the returned keys and stops at the end of the table's keyspace.
+type tableIterator struct {
+	iter   Iterator
+	prefix []byte
+	done   bool
+}
+
+func (it *tableIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	if !it.iter.Next() || !bytes.HasPrefix(it.iter.Key(), it.prefix) {
+		it.done = true
+		return false
+	}
+	return true
+}
+
+func (it *tableIterator) Error() error {
+	return it.iter.Error()
+}
+
+func (it *tableIterator) Key() []byte {
+	if it.done {
+		return nil
+	}
+	if key := it.iter.Key(); key != nil {
+		return key[len(it.prefix):]
+	}
+	return nil
+}
+
+func (it *tableIterator) Value() []byte {
+	if it.done {
+		return nil
+	}
+	return it.iter.Value()
+}
+
+func (it *tableIterator) Release() {
+	it.iter.Release()
+}
+
 type tableBatch struct {
 	batch  Batch
 	prefix string
@@ -356,6 +436,10 @@ func (tb *tableBatch) Put(key, value []byte) error {
 	return tb.batch.Put(append([]byte(tb.prefix), key...), value)
 }
 
+func (tb *tableBatch) Delete(key []byte) error {
+	return tb.batch.Delete(append([]byte(tb.prefix), key...))
+}
+
 func (tb *tableBatch) Write() error {
 	return tb.batch.Write()
 }
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strconv"
 	"sync"
 	"testing"
@@ -44,6 +45,22 @@ func newTestLDB() (*ethdb.LDBDatabase, func()) {
 	}
 }
 
+func newTestBoltDB() (*ethdb.BoltDatabase, func()) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "ethdb_test_")
+	if err != nil {
+		panic("failed to create test file: " + err.Error())
+	}
+	db, err := ethdb.NewBoltDatabase(dirname, 0, 0)
+	if err != nil {
+		panic("failed to create test database: " + err.Error())
+	}
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dirname)
+	}
+}
+
 var test_values = []string{"", "a", "1251", "\x00123\x00"}
 
 func TestLDB_PutGet(t *testing.T) {
@@ -57,6 +74,12 @@ func TestMemoryDB_PutGet(t *testing.T) {
 	testPutGet(db, t)
 }
 
+func TestBoltDB_PutGet(t *testing.T) {
+	db, remove := newTestBoltDB()
+	defer remove()
+	testPutGet(db, t)
+}
+
 func testPutGet(db ethdb.Database, t *testing.T) {
 	t.Parallel()
 
@@ -135,6 +158,12 @@ func TestMemoryDB_ParallelPutGet(t *testing.T) {
 	testParallelPutGet(db, t)
 }
 
+func TestBoltDB_ParallelPutGet(t *testing.T) {
+	db, remove := newTestBoltDB()
+	defer remove()
+	testParallelPutGet(db, t)
+}
+
 func testParallelPutGet(db ethdb.Database, t *testing.T) {
 	const n = 8
 	var pending sync.WaitGroup
@@ -190,3 +219,141 @@ func testParallelPutGet(db ethdb.Database, t *testing.T) {
 	}
 	pending.Wait()
 }
+
+func TestLDB_Iterator(t *testing.T) {
+	db, remove := newTestLDB()
+	defer remove()
+	testIterator(db, t)
+}
+
+func TestMemoryDB_Iterator(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	testIterator(db, t)
+}
+
+func TestBoltDB_Iterator(t *testing.T) {
+	db, remove := newTestBoltDB()
+	defer remove()
+	testIterator(db, t)
+}
+
+// Tests that bolt iterators correctly continue across the chunks they load the
+// database content in, even if the database is modified meanwhile.
+func TestBoltDB_IteratorChunks(t *testing.T) {
+	db, remove := newTestBoltDB()
+	defer remove()
+
+	batch := db.NewBatch()
+	for i := 0; i < 5000; i++ {
+		batch.Put([]byte(fmt.Sprintf("%05d", i)), []byte{byte(i)})
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatalf("batch write failed: %v", err)
+	}
+	it := db.NewIterator()
+	defer it.Release()
+
+	count := 0
+	for ; it.Next(); count++ {
+		if want := fmt.Sprintf("%05d", count); string(it.Key()) != want {
+			t.Fatalf("key mismatch: have %q, want %q", it.Key(), want)
+		}
+		if err := db.Delete(it.Key()); err != nil {
+			t.Fatalf("delete failed: %v", err)
+		}
+	}
+	if count != 5000 {
+		t.Fatalf("iterated item count mismatch: have %d, want %d", count, 5000)
+	}
+}
+
+// Tests that databases are reopened with the engine they were created with and
+// refuse to be opened with a different one.
+func TestDatabaseEngine(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "ethdb_test_")
+	if err != nil {
+		t.Fatalf("failed to create test dir: %v", err)
+	}
+	defer os.RemoveAll(dirname)
+
+	db, err := ethdb.NewDatabase(ethdb.EngineBoltDB, dirname, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	db.Put([]byte("key"), []byte("value"))
+	db.Close()
+
+	if _, err := ethdb.NewDatabase(ethdb.EngineLevelDB, dirname, 0, 0); err == nil {
+		t.Fatalf("opened bolt database with leveldb")
+	}
+	db, err = ethdb.NewDatabase("", dirname, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	if _, ok := db.(*ethdb.BoltDatabase); !ok {
+		t.Fatalf("engine mismatch: have %T", db)
+	}
+	if value, err := db.Get([]byte("key")); err != nil || string(value) != "value" {
+		t.Fatalf("value mismatch: have %q, %v", value, err)
+	}
+}
+
+func TestTable_Iterator(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	// Insert some data around the table to ensure it doesn't leak into iteration
+	db.Put([]byte("s"), []byte("before"))
+	db.Put([]byte("u"), []byte("after"))
+
+	testIterator(ethdb.NewTable(db, "t"), t)
+}
+
+func testIterator(db ethdb.Database, t *testing.T) {
+	keys := []string{"1", "2", "3", "4", "6", "10", "11", "12", "20", "21", "22"}
+	for _, k := range keys {
+		if err := db.Put([]byte(k), []byte("v"+k)); err != nil {
+			t.Fatalf("put failed: %v", err)
+		}
+	}
+	tests := []struct {
+		start, prefix string
+		iter          func() ethdb.Iterator
+		want          []string
+	}{
+		{iter: db.NewIterator, want: []string{"1", "10", "11", "12", "2", "20", "21", "22", "3", "4", "6"}},
+		{start: "2", want: []string{"2", "20", "21", "22", "3", "4", "6"}},
+		{start: "5", want: []string{"6"}},
+		{start: "7", want: nil},
+		{prefix: "1", want: []string{"1", "10", "11", "12"}},
+		{prefix: "2", want: []string{"2", "20", "21", "22"}},
+		{prefix: "5", want: nil},
+	}
+	for i, tt := range tests {
+		var it ethdb.Iterator
+		switch {
+		case tt.iter != nil:
+			it = tt.iter()
+		case tt.prefix != "":
+			it = db.NewIteratorWithPrefix([]byte(tt.prefix))
+		default:
+			it = db.NewIteratorWithStart([]byte(tt.start))
+		}
+		var have []string
+		for it.Next() {
+			if !bytes.Equal(it.Value(), []byte("v"+string(it.Key()))) {
+				t.Errorf("test %d: value mismatch for key %q: have %q", i, it.Key(), it.Value())
+			}
+			have = append(have, string(it.Key()))
+		}
+		if err := it.Error(); err != nil {
+			t.Errorf("test %d: iteration failed: %v", i, err)
+		}
+		it.Release()
+
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("test %d: key mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
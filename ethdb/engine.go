@@ -0,0 +1,68 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// EngineLevelDB is the name of the LevelDB database engine.
+	EngineLevelDB = "leveldb"
+
+	// EngineBoltDB is the name of the BoltDB database engine.
+	EngineBoltDB = "boltdb"
+)
+
+// NewDatabase opens a persistent key-value store with the requested engine. If
+// no engine is specified, the one of the existing database is used, falling back
+// to LevelDB for new ones. Opening an existing database with a different engine
+// is refused.
+func NewDatabase(engine string, file string, cache int, handles int) (Database, error) {
+	existing := detectEngine(file)
+	if engine == "" {
+		engine = existing
+		if engine == "" {
+			engine = EngineLevelDB
+		}
+	}
+	if existing != "" && existing != engine {
+		return nil, fmt.Errorf("database %s uses engine %q, not %q", file, existing, engine)
+	}
+	switch engine {
+	case EngineLevelDB:
+		return NewLDBDatabase(file, cache, handles)
+	case EngineBoltDB:
+		return NewBoltDatabase(file, cache, handles)
+	default:
+		return nil, fmt.Errorf("unknown database engine %q", engine)
+	}
+}
+
+// detectEngine returns the engine of the database at the given path, or an empty
+// string if no database exists there yet.
+func detectEngine(file string) string {
+	if _, err := os.Stat(filepath.Join(file, boltFile)); err == nil {
+		return EngineBoltDB
+	}
+	if _, err := os.Stat(filepath.Join(file, "CURRENT")); err == nil {
+		return EngineLevelDB
+	}
+	return ""
+}
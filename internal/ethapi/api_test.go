@@ -0,0 +1,175 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testBackend is a Backend serving calls on top of a fixed state. Any method
+// not needed for executing calls panics.
+type testBackend struct {
+	Backend
+
+	state  *state.StateDB
+	header *types.Header
+}
+
+func (b *testBackend) AccountManager() *accounts.Manager { return nil }
+
+func (b *testBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	return b.state.Copy(), b.header, nil
+}
+
+func (b *testBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmCfg vm.Config) (*vm.EVM, func() error, error) {
+	state.SetBalance(msg.From(), math.MaxBig256)
+	context := core.NewEVMContext(msg, header, nil, &header.Coinbase)
+	return vm.NewEVM(context, state, params.TestChainConfig, vmCfg), func() error { return nil }, nil
+}
+
+// Tests that eth_call applies the requested account overrides on top of the
+// state, without modifying the state itself.
+func TestCallStateOverrides(t *testing.T) {
+	var (
+		sender  = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+		reader  = common.HexToAddress("0x000000000000000000000000000000000000bbbb")
+		empty   = common.HexToAddress("0x000000000000000000000000000000000000cccc")
+		creator = common.HexToAddress("0x000000000000000000000000000000000000dddd")
+
+		// Returns its own balance and the storage slots 0 and 1:
+		//   MSTORE(0, BALANCE(ADDRESS)) MSTORE(32, SLOAD(0)) MSTORE(64, SLOAD(1)) RETURN(0, 96)
+		readerCode = common.FromHex("0x303160005260005460205260015460405260606000f3")
+
+		// Returns the address of an empty contract it creates:
+		//   MSTORE(0, CREATE(0, 0, 0)) RETURN(0, 32)
+		creatorCode = common.FromHex("0x600060006000f060005260206000f3")
+	)
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.SetCode(reader, readerCode)
+	statedb.SetBalance(reader, big.NewInt(5))
+	statedb.SetState(reader, common.BigToHash(big.NewInt(0)), common.BigToHash(big.NewInt(1)))
+	statedb.SetState(reader, common.BigToHash(big.NewInt(1)), common.BigToHash(big.NewInt(2)))
+	statedb.SetCode(creator, creatorCode)
+	statedb.SetNonce(creator, 1)
+
+	api := NewPublicBlockChainAPI(&testBackend{
+		state:  statedb,
+		header: &types.Header{Number: big.NewInt(1), GasLimit: 8000000, Time: big.NewInt(0), Difficulty: big.NewInt(1)},
+	})
+	words := func(vals ...int64) []byte {
+		var out []byte
+		for _, val := range vals {
+			out = append(out, common.BigToHash(big.NewInt(val)).Bytes()...)
+		}
+		return out
+	}
+	var (
+		balance = hexutil.Big(*big.NewInt(7))
+		pbal    = &balance
+		nonce   = hexutil.Uint64(5)
+		code    = hexutil.Bytes(readerCode)
+		slots   = map[common.Hash]common.Hash{common.BigToHash(big.NewInt(1)): common.BigToHash(big.NewInt(9))}
+	)
+	tests := []struct {
+		to        common.Address
+		overrides *StateOverride
+		want      []byte
+		fail      bool
+	}{
+		// No overrides, the original state must be used
+		{to: reader, want: words(5, 1, 2)},
+		{to: empty, overrides: &StateOverride{}, want: nil},
+
+		// Individual account fields overridden
+		{to: reader, overrides: &StateOverride{reader: {Balance: &pbal}}, want: words(7, 1, 2)},
+		{to: empty, overrides: &StateOverride{empty: {Code: &code}}, want: words(0, 0, 0)},
+		{to: creator, overrides: &StateOverride{creator: {Nonce: &nonce}}, want: common.BytesToHash(crypto.CreateAddress(creator, 5).Bytes()).Bytes()},
+
+		// Storage overridden slot by slot or entirely
+		{to: reader, overrides: &StateOverride{reader: {StateDiff: slots}}, want: words(5, 1, 9)},
+		{to: reader, overrides: &StateOverride{reader: {State: &slots}}, want: words(5, 0, 9)},
+		{to: reader, overrides: &StateOverride{reader: {State: &slots, StateDiff: slots}}, fail: true},
+
+		// The overrides must not leak into subsequent calls
+		{to: reader, want: words(5, 1, 2)},
+		{to: creator, want: common.BytesToHash(crypto.CreateAddress(creator, 1).Bytes()).Bytes()},
+	}
+	for i, tt := range tests {
+		to := tt.to
+		res, err := api.Call(context.Background(), CallArgs{From: sender, To: &to}, rpc.LatestBlockNumber, tt.overrides)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: expected failure, got result %x", i, res)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: call failed: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(res, tt.want) {
+			t.Errorf("test %d: result mismatch: have %x, want %x", i, res, tt.want)
+		}
+	}
+}
+
+// Tests that eth_estimateGas applies the requested account overrides too.
+func TestEstimateGasStateOverrides(t *testing.T) {
+	var (
+		sender = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+		guard  = common.HexToAddress("0x000000000000000000000000000000000000bbbb")
+	)
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	// Fails unless the storage slot 0 is set: JUMPI(7, SLOAD(0)) INVALID JUMPDEST STOP
+	statedb.SetCode(guard, common.FromHex("0x600054600757fe5b00"))
+
+	api := NewPublicBlockChainAPI(&testBackend{
+		state:  statedb,
+		header: &types.Header{Number: big.NewInt(1), GasLimit: 8000000, Time: big.NewInt(0), Difficulty: big.NewInt(1)},
+	})
+	args := CallArgs{From: sender, To: &guard, Gas: 100000}
+	if _, err := api.EstimateGas(context.Background(), args, nil); err == nil {
+		t.Fatalf("estimation succeeded without overrides")
+	}
+	overrides := &StateOverride{guard: {StateDiff: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(1))}}}
+	gas, err := api.EstimateGas(context.Background(), args, overrides)
+	if err != nil {
+		t.Fatalf("failed to estimate gas with overrides: %v", err)
+	}
+	if gas <= hexutil.Uint64(params.TxGas) || gas >= 100000 {
+		t.Errorf("gas estimate out of range: have %d", gas)
+	}
+}
@@ -57,12 +57,12 @@ type Miner struct {
 	shouldStart int32 // should start indicates whether we should start after sync
 }
 
-func New(eth Backend, config *params.ChainConfig, mux *event.TypeMux, engine consensus.Engine) *Miner {
+func New(eth Backend, config *params.ChainConfig, mux *event.TypeMux, engine consensus.Engine, gasFloor, gasCeil uint64) *Miner {
 	miner := &Miner{
 		eth:      eth,
 		mux:      mux,
 		engine:   engine,
-		worker:   newWorker(config, engine, common.Address{}, eth, mux),
+		worker:   newWorker(config, engine, common.Address{}, eth, mux, gasFloor, gasCeil),
 		canStart: 1,
 	}
 	miner.Register(NewCpuAgent(eth.BlockChain(), engine))
@@ -163,6 +163,34 @@ func (self *Miner) SetExtra(extra []byte) error {
 	return nil
 }
 
+// SetGasLimit changes the range the gas limit of the mined blocks is steered
+// towards. A zero ceiling leaves the gas limit uncapped upwards.
+func (self *Miner) SetGasLimit(gasFloor, gasCeil uint64) error {
+	if err := ValidateGasLimit(gasFloor, gasCeil); err != nil {
+		return err
+	}
+	self.worker.setGasLimit(gasFloor, gasCeil)
+	return nil
+}
+
+// ValidateGasLimit checks that the gas floor and ceiling targets are usable for
+// mining, a zero ceiling meaning that the gas limit is not capped.
+func ValidateGasLimit(gasFloor, gasCeil uint64) error {
+	if gasFloor < params.MinGasLimit {
+		return fmt.Errorf("gas floor below minimum: %d < %d", gasFloor, params.MinGasLimit)
+	}
+	if gasCeil != 0 && gasCeil < gasFloor {
+		return fmt.Errorf("gas ceiling below floor: %d < %d", gasCeil, gasFloor)
+	}
+	return nil
+}
+
+// SetOrdering replaces the strategy used to fill new blocks with the pending
+// transactions of the pool.
+func (self *Miner) SetOrdering(ordering Ordering) {
+	self.worker.setOrdering(ordering)
+}
+
 // Pending returns the currently pending block and associated state.
 func (self *Miner) Pending() (*types.Block, *state.StateDB) {
 	return self.worker.pending()
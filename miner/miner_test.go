@@ -0,0 +1,43 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that only usable gas floor and ceiling targets are accepted for mining.
+func TestValidateGasLimit(t *testing.T) {
+	tests := []struct {
+		floor, ceil uint64
+		ok          bool
+	}{
+		{params.GenesisGasLimit, 0, true},
+		{params.GenesisGasLimit, params.GenesisGasLimit, true},
+		{params.MinGasLimit, 2 * params.MinGasLimit, true},
+		{0, 0, false},
+		{params.MinGasLimit - 1, 0, false},
+		{params.GenesisGasLimit, params.GenesisGasLimit - 1, false},
+	}
+	for i, tt := range tests {
+		if err := ValidateGasLimit(tt.floor, tt.ceil); (err == nil) != tt.ok {
+			t.Errorf("test %d: floor %d, ceil %d: validity mismatch: have %v, want %v", i, tt.floor, tt.ceil, err == nil, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TransactionSet is a sequence of transactions the worker fills a block from.
+// Peek returns the next transaction to commit, Shift replaces it with the next
+// one from the same account and Pop discards the rest of the account.
+type TransactionSet interface {
+	Peek() *types.Transaction
+	Shift()
+	Pop()
+}
+
+// Ordering is a block filling strategy, deciding in which order the pending
+// transactions of the pool are included into new blocks.
+type Ordering interface {
+	Order(signer types.Signer, pending map[common.Address]types.Transactions) TransactionSet
+}
+
+// OrderingConstructor creates an ordering operating on the given backend.
+type OrderingConstructor func(eth Backend) Ordering
+
+var (
+	orderingsMu sync.RWMutex
+	orderings   = map[string]OrderingConstructor{
+		"price":   func(Backend) Ordering { return PriceOrdering{} },
+		"arrival": func(eth Backend) Ordering { return NewArrivalOrdering(eth.TxPool().ArrivalTime) },
+	}
+)
+
+// RegisterOrdering makes a block filling strategy selectable by name. It fails
+// if the name is already taken.
+func RegisterOrdering(name string, constructor OrderingConstructor) error {
+	orderingsMu.Lock()
+	defer orderingsMu.Unlock()
+
+	if _, ok := orderings[name]; ok {
+		return fmt.Errorf("ordering %q already registered", name)
+	}
+	orderings[name] = constructor
+	return nil
+}
+
+// NewOrdering creates the block filling strategy registered under the given
+// name, defaulting to price ordering if no name is given.
+func NewOrdering(name string, eth Backend) (Ordering, error) {
+	if name == "" {
+		return PriceOrdering{}, nil
+	}
+	orderingsMu.RLock()
+	constructor, ok := orderings[name]
+	orderingsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown ordering %q", name)
+	}
+	return constructor(eth), nil
+}
+
+// PriceOrdering fills blocks with the best paying transactions first, while
+// honouring the nonce order of each account.
+type PriceOrdering struct{}
+
+// Order implements Ordering, returning a price and nonce sorted set.
+func (PriceOrdering) Order(signer types.Signer, pending map[common.Address]types.Transactions) TransactionSet {
+	return types.NewTransactionsByPriceAndNonce(signer, pending)
+}
+
+// ArrivalOrdering fills blocks first-come-first-served, including transactions
+// in the order they arrived into the pool while honouring account nonces.
+type ArrivalOrdering struct {
+	arrival func(hash common.Hash) time.Time
+}
+
+// NewArrivalOrdering creates a first-come-first-served ordering based on the
+// given arrival time source, usually the transaction pool's.
+func NewArrivalOrdering(arrival func(hash common.Hash) time.Time) *ArrivalOrdering {
+	return &ArrivalOrdering{arrival: arrival}
+}
+
+// Order implements Ordering, returning an arrival time and nonce sorted set.
+func (o *ArrivalOrdering) Order(signer types.Signer, pending map[common.Address]types.Transactions) TransactionSet {
+	set := &arrivalSet{
+		signer:  signer,
+		arrival: o.arrival,
+		txs:     make(map[common.Address]types.Transactions, len(pending)),
+	}
+	for from, txs := range pending {
+		if len(txs) == 0 {
+			continue
+		}
+		set.heads = append(set.heads, &arrivalHead{tx: txs[0], time: o.arrival(txs[0].Hash())})
+		set.txs[from] = txs[1:]
+	}
+	heap.Init(&set.heads)
+	return set
+}
+
+// arrivalHead is the next transaction of an account along with its arrival.
+type arrivalHead struct {
+	tx   *types.Transaction
+	time time.Time
+}
+
+// arrivalHeads is a heap of account heads, earliest arrival first. Ties are
+// broken by gas price to keep the ordering deterministic with coarse clocks.
+type arrivalHeads []*arrivalHead
+
+func (h arrivalHeads) Len() int { return len(h) }
+func (h arrivalHeads) Less(i, j int) bool {
+	if !h[i].time.Equal(h[j].time) {
+		return h[i].time.Before(h[j].time)
+	}
+	return h[i].tx.GasPrice().Cmp(h[j].tx.GasPrice()) > 0
+}
+func (h arrivalHeads) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *arrivalHeads) Push(x interface{}) {
+	*h = append(*h, x.(*arrivalHead))
+}
+
+func (h *arrivalHeads) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// arrivalSet is the TransactionSet produced by ArrivalOrdering.
+type arrivalSet struct {
+	signer  types.Signer
+	arrival func(hash common.Hash) time.Time
+	txs     map[common.Address]types.Transactions // Per account nonce-sorted list of remaining transactions
+	heads   arrivalHeads                          // Next transaction for each unique account
+}
+
+// Peek returns the earliest arrived transaction among the account heads.
+func (s *arrivalSet) Peek() *types.Transaction {
+	if len(s.heads) == 0 {
+		return nil
+	}
+	return s.heads[0].tx
+}
+
+// Shift replaces the current head with the next one from the same account.
+func (s *arrivalSet) Shift() {
+	from, _ := types.Sender(s.signer, s.heads[0].tx)
+	if txs, ok := s.txs[from]; ok && len(txs) > 0 {
+		s.heads[0], s.txs[from] = &arrivalHead{tx: txs[0], time: s.arrival(txs[0].Hash())}, txs[1:]
+		heap.Fix(&s.heads, 0)
+	} else {
+		heap.Pop(&s.heads)
+	}
+}
+
+// Pop removes the current head without shifting in the next transaction of the
+// same account.
+func (s *arrivalSet) Pop() {
+	heap.Pop(&s.heads)
+}
+
+// PriorityOrdering fills blocks with the transactions of a set of configured
+// senders first, ordering both the prioritised and the remaining transactions
+// using a fallback strategy.
+type PriorityOrdering struct {
+	senders  map[common.Address]struct{}
+	fallback Ordering
+}
+
+// NewPriorityOrdering creates an ordering giving precedence to the given senders,
+// ordering the rest of the transactions with the fallback strategy.
+func NewPriorityOrdering(senders []common.Address, fallback Ordering) *PriorityOrdering {
+	o := &PriorityOrdering{
+		senders:  make(map[common.Address]struct{}, len(senders)),
+		fallback: fallback,
+	}
+	for _, addr := range senders {
+		o.senders[addr] = struct{}{}
+	}
+	return o
+}
+
+// Order implements Ordering, returning the prioritised transactions first and
+// the remaining ones afterwards.
+func (o *PriorityOrdering) Order(signer types.Signer, pending map[common.Address]types.Transactions) TransactionSet {
+	var (
+		prio = make(map[common.Address]types.Transactions)
+		rest = make(map[common.Address]types.Transactions)
+	)
+	for from, txs := range pending {
+		if _, ok := o.senders[from]; ok {
+			prio[from] = txs
+		} else {
+			rest[from] = txs
+		}
+	}
+	return &chainedSet{sets: []TransactionSet{
+		o.fallback.Order(signer, prio),
+		o.fallback.Order(signer, rest),
+	}}
+}
+
+// chainedSet is a TransactionSet draining multiple sets one after the other.
+type chainedSet struct {
+	sets []TransactionSet
+}
+
+// Peek returns the next transaction of the first non-exhausted set.
+func (s *chainedSet) Peek() *types.Transaction {
+	for len(s.sets) > 0 {
+		if tx := s.sets[0].Peek(); tx != nil {
+			return tx
+		}
+		s.sets = s.sets[1:]
+	}
+	return nil
+}
+
+// Shift replaces the current transaction with the next one from the same account.
+func (s *chainedSet) Shift() {
+	if s.Peek() != nil {
+		s.sets[0].Shift()
+	}
+}
+
+// Pop removes the current transaction along with the rest of its account.
+func (s *chainedSet) Pop() {
+	if s.Peek() != nil {
+		s.sets[0].Pop()
+	}
+}
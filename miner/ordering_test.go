@@ -0,0 +1,163 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// orderingTestGroups generates a batch of accounts with nonce sorted transactions
+// of increasing gas price, along with the time each of them arrived at.
+func orderingTestGroups(t *testing.T, signer types.Signer, accounts, count int) ([]*ecdsa.PrivateKey, map[common.Address]types.Transactions, map[common.Hash]time.Time) {
+	var (
+		keys    = make([]*ecdsa.PrivateKey, accounts)
+		groups  = make(map[common.Address]types.Transactions)
+		arrived = make(map[common.Hash]time.Time)
+		start   = time.Now()
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addr := crypto.PubkeyToAddress(keys[i].PublicKey)
+
+		for j := 0; j < count; j++ {
+			tx, err := types.SignTx(types.NewTransaction(uint64(j), common.Address{}, big.NewInt(100), 100, big.NewInt(int64(i+j)), nil), signer, keys[i])
+			if err != nil {
+				t.Fatalf("failed to sign transaction: %v", err)
+			}
+			groups[addr] = append(groups[addr], tx)
+			arrived[tx.Hash()] = start.Add(time.Duration(j*accounts+i) * time.Second)
+		}
+	}
+	return keys, groups, arrived
+}
+
+// drainTransactionSet collects all the transactions of a set in order.
+func drainTransactionSet(set TransactionSet) types.Transactions {
+	var txs types.Transactions
+	for tx := set.Peek(); tx != nil; tx = set.Peek() {
+		txs = append(txs, tx)
+		set.Shift()
+	}
+	return txs
+}
+
+// Tests that the arrival ordering includes transactions first-come-first-served,
+// irrespective of their gas prices.
+func TestArrivalOrdering(t *testing.T) {
+	signer := types.HomesteadSigner{}
+	_, groups, arrived := orderingTestGroups(t, signer, 5, 5)
+
+	ordering := NewArrivalOrdering(func(hash common.Hash) time.Time { return arrived[hash] })
+	txs := drainTransactionSet(ordering.Order(signer, groups))
+	if len(txs) != 25 {
+		t.Fatalf("transaction count mismatch: have %d, want %d", len(txs), 25)
+	}
+	for i := 1; i < len(txs); i++ {
+		if prev, next := arrived[txs[i-1].Hash()], arrived[txs[i].Hash()]; !prev.Before(next) {
+			t.Errorf("transaction %d arrived at %v before previous at %v", i, next, prev)
+		}
+	}
+}
+
+// Tests that popping an account from an arrival ordered set drops all of its
+// remaining transactions, but nothing else.
+func TestArrivalOrderingPop(t *testing.T) {
+	signer := types.HomesteadSigner{}
+	keys, groups, arrived := orderingTestGroups(t, signer, 3, 3)
+
+	ordering := NewArrivalOrdering(func(hash common.Hash) time.Time { return arrived[hash] })
+	set := ordering.Order(signer, groups)
+
+	// The first transaction is the one of the first account, drop the account
+	if from, _ := types.Sender(signer, set.Peek()); from != crypto.PubkeyToAddress(keys[0].PublicKey) {
+		t.Fatalf("first sender mismatch: have %x, want %x", from, crypto.PubkeyToAddress(keys[0].PublicKey))
+	}
+	set.Pop()
+
+	txs := drainTransactionSet(set)
+	if len(txs) != 6 {
+		t.Fatalf("transaction count mismatch: have %d, want %d", len(txs), 6)
+	}
+	for i, tx := range txs {
+		if from, _ := types.Sender(signer, tx); from == crypto.PubkeyToAddress(keys[0].PublicKey) {
+			t.Errorf("transaction %d: included from popped account", i)
+		}
+	}
+}
+
+// Tests that the priority ordering includes the transactions of the configured
+// senders first, ordering both groups with the fallback strategy.
+func TestPriorityOrdering(t *testing.T) {
+	signer := types.HomesteadSigner{}
+	keys, groups, _ := orderingTestGroups(t, signer, 5, 5)
+
+	// Prioritise the two cheapest accounts, which price ordering would put last
+	priority := map[common.Address]bool{
+		crypto.PubkeyToAddress(keys[0].PublicKey): true,
+		crypto.PubkeyToAddress(keys[1].PublicKey): true,
+	}
+	var senders []common.Address
+	for addr := range priority {
+		senders = append(senders, addr)
+	}
+	txs := drainTransactionSet(NewPriorityOrdering(senders, PriceOrdering{}).Order(signer, groups))
+	if len(txs) != 25 {
+		t.Fatalf("transaction count mismatch: have %d, want %d", len(txs), 25)
+	}
+	nonces := make(map[common.Address]uint64)
+	for i, tx := range txs {
+		from, _ := types.Sender(signer, tx)
+		if prioritised := i < 10; priority[from] != prioritised {
+			t.Errorf("transaction %d: priority mismatch: have %v, want %v", i, priority[from], prioritised)
+		}
+		if tx.Nonce() != nonces[from] {
+			t.Errorf("transaction %d: nonce mismatch: have %d, want %d", i, tx.Nonce(), nonces[from])
+		}
+		nonces[from]++
+	}
+}
+
+// Tests that orderings can be registered and selected by name.
+func TestOrderingRegistry(t *testing.T) {
+	if ordering, err := NewOrdering("", nil); err != nil {
+		t.Fatalf("failed to create default ordering: %v", err)
+	} else if _, ok := ordering.(PriceOrdering); !ok {
+		t.Errorf("default ordering mismatch: have %T, want %T", ordering, PriceOrdering{})
+	}
+	if _, err := NewOrdering("ordering-test", nil); err == nil {
+		t.Errorf("unregistered ordering created")
+	}
+	custom := NewPriorityOrdering(nil, PriceOrdering{})
+	if err := RegisterOrdering("ordering-test", func(Backend) Ordering { return custom }); err != nil {
+		t.Fatalf("failed to register ordering: %v", err)
+	}
+	if err := RegisterOrdering("ordering-test", func(Backend) Ordering { return custom }); err == nil {
+		t.Errorf("duplicate ordering registered")
+	}
+	if ordering, err := NewOrdering("ordering-test", nil); err != nil {
+		t.Fatalf("failed to create registered ordering: %v", err)
+	} else if ordering != custom {
+		t.Errorf("registered ordering mismatch: have %v, want %v", ordering, custom)
+	}
+}
@@ -66,6 +66,11 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DatabaseEngine is the key-value store backing the persistent databases
+	// ("leveldb" or "boltdb"). If empty, existing databases are opened with the
+	// engine they were created with, new ones default to LevelDB.
+	DatabaseEngine string `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
@@ -18,6 +18,8 @@ package tests
 
 import (
 	"testing"
+
+	"github.com/ethereum/go-ethereum/core/vm"
 )
 
 func TestBlockchain(t *testing.T) {
@@ -37,7 +39,7 @@ func TestBlockchain(t *testing.T) {
 	bt.skipLoad(`^bcWalletTest.*_Byzantium$`)
 
 	bt.walk(t, blockTestDir, func(t *testing.T, name string, test *BlockTest) {
-		if err := bt.checkFailure(t, name, test.Run()); err != nil {
+		if err := bt.checkFailure(t, name, test.Run(vm.Config{})); err != nil {
 			t.Error(err)
 		}
 	})
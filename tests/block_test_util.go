@@ -91,7 +91,31 @@ type btHeaderMarshaling struct {
 	Timestamp  *math.HexOrDecimal256
 }
 
-func (t *BlockTest) Run() error {
+// BlockTestError is returned when a block of a blockchain test could not be
+// processed as the test expected, containing the details of the failing block.
+type BlockTestError struct {
+	Number   uint64       // Number of the failing block
+	Hash     common.Hash  // Hash of the failing block
+	WantRoot common.Hash  // State root the test expects after the block, if known
+	HaveRoot *common.Hash // State root computed by processing the block, if any
+	Err      error        // Reason of the failure
+}
+
+func (e *BlockTestError) Error() string {
+	if e.HaveRoot != nil && *e.HaveRoot != e.WantRoot {
+		return fmt.Sprintf("block #%d [%x…]: %v (state root want: %x, have: %x)", e.Number, e.Hash[:4], e.Err, e.WantRoot, *e.HaveRoot)
+	}
+	return fmt.Sprintf("block #%d [%x…]: %v", e.Number, e.Hash[:4], e.Err)
+}
+
+// Network returns the name of the fork rules the test is run with.
+func (t *BlockTest) Network() string {
+	return t.json.Network
+}
+
+// Run executes the blockchain test with the given EVM configuration, returning
+// a *BlockTestError if any block was not processed as the test expected.
+func (t *BlockTest) Run(vmconfig vm.Config) error {
 	config, ok := Forks[t.json.Network]
 	if !ok {
 		return UnsupportedForkError{t.json.Network}
@@ -110,7 +134,7 @@ func (t *BlockTest) Run() error {
 		return fmt.Errorf("genesis block state root does not match test: computed=%x, test=%x", gblock.Root().Bytes()[:6], t.json.Genesis.StateRoot[:6])
 	}
 
-	chain, err := core.NewBlockChain(db, nil, config, ethash.NewShared(), vm.Config{})
+	chain, err := core.NewBlockChain(db, nil, config, ethash.NewShared(), vmconfig)
 	if err != nil {
 		return err
 	}
@@ -122,14 +146,21 @@ func (t *BlockTest) Run() error {
 	}
 	cmlast := chain.CurrentBlock().Hash()
 	if common.Hash(t.json.BestBlock) != cmlast {
-		return fmt.Errorf("last block hash validation mismatch: want: %x, have: %x", t.json.BestBlock, cmlast)
+		failure := headError(chain, fmt.Errorf("last block hash validation mismatch: want: %x, have: %x", t.json.BestBlock, cmlast))
+		for _, b := range t.json.Blocks {
+			if b.BlockHeader != nil && b.BlockHeader.Hash == common.Hash(t.json.BestBlock) {
+				root := chain.CurrentBlock().Root()
+				failure.WantRoot, failure.HaveRoot = b.BlockHeader.StateRoot, &root
+			}
+		}
+		return failure
 	}
 	newDB, err := chain.State()
 	if err != nil {
 		return err
 	}
 	if err = t.validatePostState(newDB); err != nil {
-		return fmt.Errorf("post state validation failed: %v", err)
+		return headError(chain, fmt.Errorf("post state validation failed: %v", err))
 	}
 	return t.validateImportedHeaders(chain, validBlocks)
 }
@@ -176,27 +207,64 @@ func (t *BlockTest) insertBlocks(blockchain *core.BlockChain) ([]btBlock, error)
 		}
 		// RLP decoding worked, try to insert into chain:
 		blocks := types.Blocks{cb}
-		i, err := blockchain.InsertChain(blocks)
-		if err != nil {
+		if _, err := blockchain.InsertChain(blocks); err != nil {
 			if b.BlockHeader == nil {
 				continue // OK - block is supposed to be invalid, continue with next block
 			} else {
-				return nil, fmt.Errorf("Block #%v insertion into chain failed: %v", blocks[i].Number(), err)
+				return nil, blockError(blockchain, cb, fmt.Errorf("Block insertion into chain failed: %v", err))
 			}
 		}
 		if b.BlockHeader == nil {
-			return nil, fmt.Errorf("Block insertion should have failed")
+			return nil, blockError(blockchain, cb, fmt.Errorf("Block insertion should have failed"))
 		}
 
 		// validate RLP decoding by checking all values against test file JSON
 		if err = validateHeader(b.BlockHeader, cb.Header()); err != nil {
-			return nil, fmt.Errorf("Deserialised block header validation failed: %v", err)
+			return nil, blockError(blockchain, cb, fmt.Errorf("Deserialised block header validation failed: %v", err))
 		}
 		validBlocks = append(validBlocks, b)
 	}
 	return validBlocks, nil
 }
 
+// blockError wraps a failure of the given block into a *BlockTestError. The
+// block is reexecuted on top of its parent to retrieve the state root it
+// actually results in, if possible.
+func blockError(blockchain *core.BlockChain, block *types.Block, err error) *BlockTestError {
+	failure := &BlockTestError{
+		Number:   block.NumberU64(),
+		Hash:     block.Hash(),
+		WantRoot: block.Root(),
+		Err:      err,
+	}
+	parent := blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return failure
+	}
+	statedb, err := blockchain.StateAt(parent.Root())
+	if err != nil {
+		return failure
+	}
+	if _, _, _, err := blockchain.Processor().Process(block, statedb, vm.Config{}); err != nil {
+		return failure
+	}
+	root := statedb.IntermediateRoot(blockchain.Config().IsEIP158(block.Number()))
+	failure.HaveRoot = &root
+	return failure
+}
+
+// headError wraps a failure detected after importing all the blocks into a
+// *BlockTestError, attributing it to the head block of the chain. The state
+// roots are left empty, the error itself is expected to describe the mismatch.
+func headError(chain *core.BlockChain, err error) *BlockTestError {
+	head := chain.CurrentBlock()
+	return &BlockTestError{
+		Number: head.NumberU64(),
+		Hash:   head.Hash(),
+		Err:    err,
+	}
+}
+
 func validateHeader(h *btHeader, h2 *types.Header) error {
 	if h.Bloom != h2.Bloom {
 		return fmt.Errorf("Bloom: want: %x have: %x", h.Bloom, h2.Bloom)
@@ -254,13 +322,13 @@ func (t *BlockTest) validatePostState(statedb *state.StateDB) error {
 		balance2 := statedb.GetBalance(addr)
 		nonce2 := statedb.GetNonce(addr)
 		if !bytes.Equal(code2, acct.Code) {
-			return fmt.Errorf("account code mismatch for addr: %s want: %v have: %s", addr, acct.Code, hex.EncodeToString(code2))
+			return fmt.Errorf("account code mismatch for addr: %x want: %v have: %s", addr, acct.Code, hex.EncodeToString(code2))
 		}
 		if balance2.Cmp(acct.Balance) != 0 {
-			return fmt.Errorf("account balance mismatch for addr: %s, want: %d, have: %d", addr, acct.Balance, balance2)
+			return fmt.Errorf("account balance mismatch for addr: %x, want: %d, have: %d", addr, acct.Balance, balance2)
 		}
 		if nonce2 != acct.Nonce {
-			return fmt.Errorf("account nonce mismatch for addr: %s want: %d have: %d", addr, acct.Nonce, nonce2)
+			return fmt.Errorf("account nonce mismatch for addr: %x want: %d have: %d", addr, acct.Nonce, nonce2)
 		}
 	}
 	return nil